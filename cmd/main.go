@@ -2,14 +2,17 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/vontikov/pgcluster/internal/app"
 	"github.com/vontikov/pgcluster/internal/env"
 	"github.com/vontikov/pgcluster/internal/gateway"
+	"github.com/vontikov/pgcluster/internal/hook"
 	"github.com/vontikov/pgcluster/internal/logging"
 	"github.com/vontikov/pgcluster/internal/metric"
 	"github.com/vontikov/pgcluster/internal/pg"
@@ -24,6 +27,11 @@ const (
 	defaultLogLevel        = "info"
 	defaultMetricsEnabled  = "true"
 	defaultProfilerEnabled = "false"
+	defaultEscalateAfter   = "0"
+	defaultSupervise       = "false"
+	defaultSnapshotKeep    = "0"
+	defaultSnapshotMaxAge  = "0s"
+	defaultSnapshotMinFree = "0"
 )
 
 func main() {
@@ -45,19 +53,38 @@ func main() {
 	)
 	ctx, cancel := context.WithCancel(context.Background())
 
+	supervise := env.GetOrDefault(env.Supervise, defaultSupervise)
+	promotionTimeout, err := time.ParseDuration(env.GetOrDefault(env.PromotionTimeout, pg.DefaultPromotionTimeout.String()))
+	util.PanicOnError(err)
+	statementTimeout, err := time.ParseDuration(env.GetOrDefault(env.StatementTimeout, pg.DefaultStatementTimeout.String()))
+	util.PanicOnError(err)
+
 	cluster := pg.New(ctx,
 		pg.WithDatabase(pg.DefaultDatabase),
 		pg.WithHost(pg.DefaultHost),
 		pg.WithPort(pg.DefaultPort),
 		pg.WithUser(env.GetOrDefault(env.PgUser, pg.DefaultUser)),
 		pg.WithPasswordFile(env.GetOrDefault(env.PgPasswordFile, pg.DefaultPasswordFile)),
+		pg.WithSupervisor(supervise),
+		pg.WithPromotionTimeout(promotionTimeout),
+		pg.WithStatementTimeout(statementTimeout),
+		pg.WithSnapshotKeep(env.GetOrDefault(env.SnapshotKeep, defaultSnapshotKeep)),
+		pg.WithSnapshotMaxAge(env.GetOrDefault(env.SnapshotMaxAge, defaultSnapshotMaxAge)),
+		pg.WithSnapshotMinFree(env.GetOrDefault(env.SnapshotMinFree, defaultSnapshotMinFree)),
+		pg.WithSlotName(hostname),
 	)
 
-	metric.Init(ctx, hostname, cluster)
+	if r, _ := strconv.ParseBool(supervise); r {
+		err = cluster.Start(ctx)
+		util.PanicOnError(err)
+	}
 
-	major, minor, err := cluster.Version()
+	major, minor, err := cluster.Version(ctx)
 	util.PanicOnError(err)
 	logger.Info("PostgreSQL version", "major", major, "minor", minor)
+	if major < pg.MinSupportedVersion {
+		logger.Warn("unsupported PostgreSQL version", "min", pg.MinSupportedVersion)
+	}
 
 	storageBootstrap, err := env.Get(env.StorageBootstrap)
 	util.PanicOnError(err)
@@ -72,27 +99,71 @@ func main() {
 	)
 	util.PanicOnError(err)
 
-	s := sentinel.New(cluster, storageClient, hostname, pg.DefaultPort)
+	httpPort := env.GetOrDefault(env.HttpPort, defaultHttpPort)
+
+	hooks := hook.New(
+		hook.WithAction(hook.OnStart, env.GetOrDefault(env.HookOnStart, "")),
+		hook.WithAction(hook.OnStop, env.GetOrDefault(env.HookOnStop, "")),
+		hook.WithAction(hook.OnRoleChange, env.GetOrDefault(env.HookOnRoleChange, "")),
+		hook.WithAction(hook.OnPromote, env.GetOrDefault(env.HookOnPromote, "")),
+		hook.WithAction(hook.OnFollow, env.GetOrDefault(env.HookOnFollow, "")),
+		hook.WithTimeout(env.GetOrDefault(env.HookTimeout, hook.DefaultTimeout.String())),
+	)
+
+	s := sentinel.New(cluster, storageClient, hostname, pg.DefaultPort,
+		sentinel.WithHooks(hooks),
+		sentinel.WithAPIURL(fmt.Sprintf("http://%s:%s", hostname, httpPort)),
+		sentinel.WithTags(env.GetOrDefault(env.Tags, "")),
+		sentinel.WithMaxLag(env.GetOrDefault(env.FailoverMaxLag, strconv.Itoa(sentinel.DefaultMaxLag))),
+		sentinel.WithSwitchoverTimeout(env.GetOrDefault(env.SwitchoverTimeout, sentinel.DefaultSwitchoverTimeout.String())),
+		sentinel.WithFailureThreshold(env.GetOrDefault(env.FailureThreshold, strconv.Itoa(sentinel.DefaultFailureThreshold))),
+		sentinel.WithProbeTimeout(env.GetOrDefault(env.ProbeTimeout, sentinel.DefaultProbeTimeout.String())),
+		sentinel.WithMinDownTime(env.GetOrDefault(env.MinDownTime, sentinel.DefaultMinDownTime.String())),
+		sentinel.WithReinitAfter(env.GetOrDefault(env.ReinitAfter, strconv.Itoa(sentinel.DefaultReinitAfter))),
+		sentinel.WithSlotDropAfter(env.GetOrDefault(env.SlotDropAfter, sentinel.DefaultSlotDropAfter.String())),
+		sentinel.WithHBARules(env.GetOrDefault(env.HBARules, "")),
+		sentinel.WithReplicationUser(env.GetOrDefault(env.PgReplicationUser, sentinel.DefaultReplicationUser)),
+		sentinel.WithReplicationNetworks(env.GetOrDefault(env.ReplicationNetworks, sentinel.DefaultReplicationNetworks)),
+		sentinel.WithUnhealthyAfter(env.GetOrDefault(env.EscalateUnhealthyAfter, defaultEscalateAfter)),
+		sentinel.WithStopAfter(env.GetOrDefault(env.EscalateStopAfter, defaultEscalateAfter)),
+		sentinel.WithExitAfter(env.GetOrDefault(env.EscalateExitAfter, defaultEscalateAfter)),
+	)
 	err = s.Prepare(ctx)
 	util.PanicOnError(err)
 
+	metric.Init(ctx, hostname, cluster, s)
+
 	gateway, err := gateway.New(ctx,
 		gateway.WithLoggerName(app.App),
-		gateway.WithHTTPPort(env.GetOrDefault(env.HttpPort, defaultHttpPort)),
+		gateway.WithHTTPPort(httpPort),
 		gateway.WithListenAddress(env.GetOrDefault(env.ListenAddress, defaultListenAddress)),
 		gateway.WithMetricsEnabled(env.GetOrDefault(env.MetricsEnabled, defaultMetricsEnabled)),
 		gateway.WithPprofEnabled(env.GetOrDefault(env.ProfilerEnabled, defaultProfilerEnabled)),
 		gateway.WithHandlers(pg.Handlers(cluster)),
+		gateway.WithHandlers(sentinel.Handlers(s)),
 	)
 	util.PanicOnError(err)
 
+	escalated := make(chan error, 1)
+	go func() { escalated <- s.Escalate(ctx) }()
+
 	go s.Start(ctx)
 	metric.Info.Set(1.0)
 	logger.Info("started")
 
-	sig := <-signals
-	logger.Debug("received signal", "type", sig)
+	code := 0
+	select {
+	case sig := <-signals:
+		logger.Debug("received signal", "type", sig)
+	case err := <-escalated:
+		logger.Error("exiting", "message", err)
+		code = 1
+	}
 	cancel()
+	<-s.Stopped()
+	// the postmaster runs in its own process group
+	<-cluster.Stopped()
 	_ = gateway.Wait()
 	logger.Info("done")
+	os.Exit(code)
 }
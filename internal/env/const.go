@@ -15,7 +15,42 @@ const (
 	MetricsEnabled  = "PGCP_METRICS_ENABLED"
 	ProfilerEnabled = "PGCP_PROFILER_ENABLED"
 
+	Supervise        = "PGCP_SUPERVISE"
+	PromotionTimeout = "PGCP_PROMOTION_TIMEOUT"
+	StatementTimeout = "PGCP_STATEMENT_TIMEOUT"
+
+	SnapshotKeep    = "PGCP_SNAPSHOT_KEEP"
+	SnapshotMaxAge  = "PGCP_SNAPSHOT_MAX_AGE"
+	SnapshotMinFree = "PGCP_SNAPSHOT_MIN_FREE"
+
 	StorageType      = "PGCP_STORAGE_TYPE"
 	StorageBootstrap = "PGCP_STORAGE_BOOTSTRAP"
 	StorageTtl       = "PGCP_STORAGE_TTL"
+
+	Tags = "PGCP_TAGS"
+
+	HookOnStart      = "PGCP_HOOK_ON_START"
+	HookOnStop       = "PGCP_HOOK_ON_STOP"
+	HookOnRoleChange = "PGCP_HOOK_ON_ROLE_CHANGE"
+	HookOnPromote    = "PGCP_HOOK_ON_PROMOTE"
+	HookOnFollow     = "PGCP_HOOK_ON_FOLLOW"
+	HookTimeout      = "PGCP_HOOK_TIMEOUT"
+
+	FailoverMaxLag    = "PGCP_FAILOVER_MAX_LAG"
+	SwitchoverTimeout = "PGCP_SWITCHOVER_TIMEOUT"
+
+	FailureThreshold = "PGCP_FAILURE_THRESHOLD"
+	ProbeTimeout     = "PGCP_PROBE_TIMEOUT"
+	MinDownTime      = "PGCP_MIN_DOWN_TIME"
+
+	ReinitAfter = "PGCP_REINIT_AFTER"
+
+	SlotDropAfter = "PGCP_SLOT_DROP_AFTER"
+
+	HBARules            = "PGCP_HBA_RULES"
+	ReplicationNetworks = "PGCP_REPLICATION_NETWORKS"
+
+	EscalateUnhealthyAfter = "PGCP_ESCALATE_UNHEALTHY_AFTER"
+	EscalateStopAfter      = "PGCP_ESCALATE_STOP_AFTER"
+	EscalateExitAfter      = "PGCP_ESCALATE_EXIT_AFTER"
 )
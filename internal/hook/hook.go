@@ -0,0 +1,179 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/logging"
+	"github.com/vontikov/pgcluster/internal/util"
+)
+
+const (
+	// DefaultLoggerName is the default name for the logger.
+	DefaultLoggerName = "hook"
+
+	// DefaultTimeout is the default timeout for an action to complete.
+	DefaultTimeout = 10 * time.Second
+
+	queueSize = 64
+)
+
+// Event types.
+const (
+	OnStart      = "on_start"
+	OnStop       = "on_stop"
+	OnRoleChange = "on_role_change"
+	OnPromote    = "on_promote"
+	OnFollow     = "on_follow"
+)
+
+// Event describes the event passed to the action as JSON.
+type Event struct {
+	Type       string    `json:"type"`
+	Node       string    `json:"node"`
+	Role       string    `json:"role"`
+	PrevRole   string    `json:"prev_role,omitempty"`
+	MasterHost string    `json:"master_host,omitempty"`
+	MasterPort int       `json:"master_port,omitempty"`
+	Term       uint64    `json:"term"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// Hooks runs the actions configured for the events. An action is either an
+// executable, which receives the event type as the argument and the event on
+// stdin, or an http(s) URL the event is POSTed to.
+type Hooks struct {
+	logger  logging.Logger
+	timeout time.Duration
+	actions map[string]string
+	queue   chan *Event
+}
+
+// Option defines configuration option.
+type Option func(*Hooks)
+
+// WithLoggerName sets logger name.
+func WithLoggerName(v string) Option {
+	return func(h *Hooks) { h.logger = logging.NewLogger(v) }
+}
+
+// WithAction sets the action for the event type. Empty action is ignored.
+func WithAction(event, action string) Option {
+	return func(h *Hooks) {
+		if action != "" {
+			h.actions[event] = action
+		}
+	}
+}
+
+// WithTimeout sets the timeout for an action to complete.
+func WithTimeout(v string) Option {
+	d, err := time.ParseDuration(v)
+	util.PanicOnError(err)
+	return func(h *Hooks) { h.timeout = d }
+}
+
+// New creates new instance.
+func New(opts ...Option) *Hooks {
+	h := &Hooks{
+		logger:  logging.NewLogger(DefaultLoggerName),
+		timeout: DefaultTimeout,
+		actions: make(map[string]string),
+		queue:   make(chan *Event, queueSize),
+	}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+// Start runs the actions of the fired events one by one until the context is
+// done.
+func (h *Hooks) Start(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-h.queue:
+			if err := h.Run(ctx, e); err != nil {
+				h.logger.Error("hook error", "type", e.Type, "message", err)
+			}
+		}
+	}
+}
+
+// Fire schedules the action of the event to be run. The event is stamped with
+// the current time unless it has been already, the action may run later.
+func (h *Hooks) Fire(e *Event) {
+	if _, ok := h.actions[e.Type]; !ok {
+		return
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	select {
+	case h.queue <- e:
+	default:
+		h.logger.Warn("hook queue is full, event dropped", "type", e.Type)
+	}
+}
+
+// Run runs the action of the event and waits for it to complete.
+func (h *Hooks) Run(ctx context.Context, e *Event) error {
+	action, ok := h.actions[e.Type]
+	if !ok {
+		return nil
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	h.logger.Debug("running hook", "type", e.Type, "action", action)
+	if strings.HasPrefix(action, "http://") || strings.HasPrefix(action, "https://") {
+		return h.post(ctx, action, payload)
+	}
+	return h.exec(ctx, action, e.Type, payload)
+}
+
+func (h *Hooks) exec(ctx context.Context, action, event string, payload []byte) error {
+	/* #nosec */
+	cmd := exec.CommandContext(ctx, action, event)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (h *Hooks) post(ctx context.Context, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
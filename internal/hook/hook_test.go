@@ -0,0 +1,121 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunExecutable(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "hook")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+	script := filepath.Join(dir, "hook.sh")
+	err = ioutil.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\necho $1 > %s.arg\ncat > %s\n", out, out)), 0700)
+	assert.Nil(err)
+
+	h := New(WithAction(OnPromote, script))
+	err = h.Run(context.Background(), &Event{Type: OnPromote, Node: "pg_replica0", Role: "master", Term: 2})
+	assert.Nil(err)
+
+	arg, err := ioutil.ReadFile(out + ".arg")
+	assert.Nil(err)
+	assert.Equal(OnPromote+"\n", string(arg))
+
+	b, err := ioutil.ReadFile(out)
+	assert.Nil(err)
+	var e Event
+	assert.Nil(json.Unmarshal(b, &e))
+	assert.Equal(OnPromote, e.Type)
+	assert.Equal("pg_replica0", e.Node)
+	assert.Equal("master", e.Role)
+	assert.Equal(uint64(2), e.Term)
+	assert.False(e.Timestamp.IsZero())
+}
+
+func TestRunURL(t *testing.T) {
+	assert := assert.New(t)
+
+	events := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		assert.Nil(json.NewDecoder(r.Body).Decode(&e))
+		events <- e
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := New(WithAction(OnRoleChange, srv.URL))
+	go h.Start(ctx)
+	h.Fire(&Event{Type: OnRoleChange, Role: "replica", PrevRole: "master"})
+	h.Fire(&Event{Type: OnFollow})
+
+	select {
+	case e := <-events:
+		assert.Equal(OnRoleChange, e.Type)
+		assert.Equal("replica", e.Role)
+		assert.Equal("master", e.PrevRole)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestFireTimestamp(t *testing.T) {
+	assert := assert.New(t)
+
+	events := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		assert.Nil(json.NewDecoder(r.Body).Decode(&e))
+		events <- e
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := New(WithAction(OnFollow, srv.URL))
+	fired := time.Now()
+	h.Fire(&Event{Type: OnFollow})
+
+	// the event is queued
+	time.Sleep(50 * time.Millisecond)
+	started := time.Now()
+	go h.Start(ctx)
+
+	select {
+	case e := <-events:
+		assert.False(e.Timestamp.Before(fired))
+		assert.True(e.Timestamp.Before(started))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer srv.Close()
+
+	h := New(WithAction(OnStop, srv.URL), WithTimeout("100ms"))
+	err := h.Run(context.Background(), &Event{Type: OnStop})
+	assert.NotNil(err)
+}
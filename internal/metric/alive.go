@@ -1,18 +1,22 @@
 package metric
 
 import (
+	"context"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/vontikov/pgcluster/internal/pg"
 )
 
 type livenessCollector struct {
-	c pg.Cluster
-	d *prometheus.Desc
+	ctx context.Context
+	c   pg.Cluster
+	d   *prometheus.Desc
 }
 
-func newLivenessCollector(hostname string, c pg.Cluster) *livenessCollector {
+func newLivenessCollector(ctx context.Context, hostname string, c pg.Cluster) *livenessCollector {
 	return &livenessCollector{
-		c: c,
+		ctx: ctx,
+		c:   c,
 		d: prometheus.NewDesc(
 			QualifiedMetricName(IsAlive),
 			"cluster liveness status",
@@ -27,7 +31,7 @@ func (c *livenessCollector) Describe(ch chan<- *prometheus.Desc) {
 
 func (c *livenessCollector) Collect(ch chan<- prometheus.Metric) {
 	var v float64
-	r, err := c.c.Alive()
+	r, err := c.c.Alive(c.ctx)
 	if r {
 		v = 1.0
 	}
@@ -1,18 +1,22 @@
 package metric
 
 import (
+	"context"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/vontikov/pgcluster/internal/pg"
 )
 
 type inRecoveryCollector struct {
-	c pg.Cluster
-	d *prometheus.Desc
+	ctx context.Context
+	c   pg.Cluster
+	d   *prometheus.Desc
 }
 
-func newInRecoveryCollector(hostname string, c pg.Cluster) *inRecoveryCollector {
+func newInRecoveryCollector(ctx context.Context, hostname string, c pg.Cluster) *inRecoveryCollector {
 	return &inRecoveryCollector{
-		c: c,
+		ctx: ctx,
+		c:   c,
 		d: prometheus.NewDesc(
 			QualifiedMetricName(InRecovery),
 			"cluster recovery status",
@@ -31,7 +35,7 @@ func (c *inRecoveryCollector) Collect(ch chan<- prometheus.Metric) {
 		ch <- prometheus.MustNewConstMetric(c.d, prometheus.GaugeValue, v)
 	}()
 
-	r, err := c.c.InRecovery()
+	r, err := c.c.InRecovery(c.ctx)
 	if err != nil {
 		v = -1.0
 		return
@@ -9,14 +9,44 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/vontikov/pgcluster/internal/app"
 	"github.com/vontikov/pgcluster/internal/pg"
+	"github.com/vontikov/pgcluster/internal/sentinel"
 )
 
 const (
 	InRecovery = "in_recovery"
 	IsAlive    = "is_alive"
+	Term       = "term"
 
-	versionLabel  = "version"
-	hostnameLabel = "hostname"
+	State              = "state"
+	LastCheckAge       = "last_check_age_seconds"
+	CheckSuccess       = "check_success_total"
+	CheckErrors        = "check_errors_total"
+	LastErrorTimestamp = "last_error_timestamp_seconds"
+
+	ConsecutiveErrors = "consecutive_errors"
+	Unhealthy         = "unhealthy"
+	Escalations       = "escalations_total"
+
+	StandbyWriteLag       = "standby_write_lag_seconds"
+	StandbyFlushLag       = "standby_flush_lag_seconds"
+	StandbyReplayLag      = "standby_replay_lag_seconds"
+	StandbyReplayLagBytes = "standby_replay_lag_bytes"
+
+	WalLSN             = "wal_lsn"
+	WalReplayLagBytes  = "wal_replay_lag_bytes"
+	WalReplayTimestamp = "wal_replay_timestamp_seconds"
+
+	Snapshots     = "snapshots"
+	SnapshotsSize = "snapshots_size_bytes"
+
+	versionLabel    = "version"
+	hostnameLabel   = "hostname"
+	stateLabel      = "state"
+	stepLabel       = "step"
+	standbyLabel    = "standby"
+	clientAddrLabel = "client_addr"
+	syncStateLabel  = "sync_state"
+	positionLabel   = "position"
 )
 
 var (
@@ -26,7 +56,7 @@ var (
 	once sync.Once
 )
 
-func Init(ctx context.Context, hostname string, cluster pg.Cluster) {
+func Init(ctx context.Context, hostname string, cluster pg.Cluster, s *sentinel.Sentinel) {
 	once.Do(func() {
 		Info = promauto.NewGauge(prometheus.GaugeOpts{
 			Namespace: app.Namespace,
@@ -39,8 +69,13 @@ func Init(ctx context.Context, hostname string, cluster pg.Cluster) {
 			},
 		})
 
-		prometheus.MustRegister(newLivenessCollector(hostname, cluster))
-		prometheus.MustRegister(newInRecoveryCollector(hostname, cluster))
+		prometheus.MustRegister(newLivenessCollector(ctx, hostname, cluster))
+		prometheus.MustRegister(newInRecoveryCollector(ctx, hostname, cluster))
+		prometheus.MustRegister(newTermCollector(hostname, s))
+		prometheus.MustRegister(newStatusCollector(hostname, s))
+		prometheus.MustRegister(newReplicationCollector(ctx, hostname, cluster))
+		prometheus.MustRegister(newWalCollector(ctx, hostname, cluster))
+		prometheus.MustRegister(newSnapshotCollector(ctx, hostname, cluster))
 	})
 }
 
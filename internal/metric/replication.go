@@ -0,0 +1,75 @@
+package metric
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vontikov/pgcluster/internal/pg"
+)
+
+type replicationCollector struct {
+	ctx            context.Context
+	c              pg.Cluster
+	writeLag       *prometheus.Desc
+	flushLag       *prometheus.Desc
+	replayLag      *prometheus.Desc
+	replayLagBytes *prometheus.Desc
+}
+
+func newReplicationCollector(ctx context.Context, hostname string, c pg.Cluster) *replicationCollector {
+	labels := map[string]string{hostnameLabel: hostname}
+	// standbys cloned from each other may share the application name
+	variable := []string{standbyLabel, clientAddrLabel, syncStateLabel}
+	return &replicationCollector{
+		ctx: ctx,
+		c:   c,
+		writeLag: prometheus.NewDesc(
+			QualifiedMetricName(StandbyWriteLag),
+			"standby write lag in seconds",
+			variable,
+			labels),
+		flushLag: prometheus.NewDesc(
+			QualifiedMetricName(StandbyFlushLag),
+			"standby flush lag in seconds",
+			variable,
+			labels),
+		replayLag: prometheus.NewDesc(
+			QualifiedMetricName(StandbyReplayLag),
+			"standby replay lag in seconds",
+			variable,
+			labels),
+		replayLagBytes: prometheus.NewDesc(
+			QualifiedMetricName(StandbyReplayLagBytes),
+			"standby replay lag in bytes",
+			variable,
+			labels),
+	}
+}
+
+func (c *replicationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.writeLag
+	ch <- c.flushLag
+	ch <- c.replayLag
+	ch <- c.replayLagBytes
+}
+
+func (c *replicationCollector) Collect(ch chan<- prometheus.Metric) {
+	r, err := c.c.ReplicationStatus(c.ctx)
+	if err != nil {
+		return
+	}
+	seen := make(map[[3]string]bool, len(r))
+	for _, s := range r {
+		// a duplicate series fails the whole scrape, e.g. the connections of
+		// pg_basebackup from the same host
+		k := [3]string{s.ApplicationName, s.ClientAddr, s.SyncState}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		ch <- prometheus.MustNewConstMetric(c.writeLag, prometheus.GaugeValue, s.WriteLag, s.ApplicationName, s.ClientAddr, s.SyncState)
+		ch <- prometheus.MustNewConstMetric(c.flushLag, prometheus.GaugeValue, s.FlushLag, s.ApplicationName, s.ClientAddr, s.SyncState)
+		ch <- prometheus.MustNewConstMetric(c.replayLag, prometheus.GaugeValue, s.ReplayLag, s.ApplicationName, s.ClientAddr, s.SyncState)
+		ch <- prometheus.MustNewConstMetric(c.replayLagBytes, prometheus.GaugeValue, float64(s.ReplayLagBytes), s.ApplicationName, s.ClientAddr, s.SyncState)
+	}
+}
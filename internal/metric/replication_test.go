@@ -0,0 +1,45 @@
+package metric
+
+import (
+	"context"
+	"testing"
+
+	gm "github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/vontikov/pgcluster/internal/pg"
+
+	mock_pg "github.com/vontikov/pgcluster/mocks/pg"
+)
+
+func TestReplicationCollector(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := mock_pg.NewMockCluster(ctrl)
+	c.EXPECT().ReplicationStatus(ctx).
+		Return([]*pg.StandbyStatus{
+			// cloned standbys share the application name
+			{ApplicationName: "walreceiver", ClientAddr: "172.18.0.3", SyncState: "async", ReplayLag: 0.1},
+			{ApplicationName: "walreceiver", ClientAddr: "172.18.0.4", SyncState: "async", ReplayLag: 0.2},
+			// pg_basebackup connects twice
+			{ApplicationName: "pg_basebackup", ClientAddr: "172.18.0.5", SyncState: "async"},
+			{ApplicationName: "pg_basebackup", ClientAddr: "172.18.0.5", SyncState: "async"},
+		}, nil).
+		Times(1)
+
+	r := prometheus.NewPedanticRegistry()
+	assert.Nil(r.Register(newReplicationCollector(ctx, "localhost", c)))
+
+	mfs, err := r.Gather()
+	assert.Nil(err)
+	assert.Len(mfs, 4)
+	for _, mf := range mfs {
+		assert.Len(mf.GetMetric(), 3, mf.GetName())
+	}
+}
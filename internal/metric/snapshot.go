@@ -0,0 +1,47 @@
+package metric
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vontikov/pgcluster/internal/pg"
+)
+
+type snapshotCollector struct {
+	ctx   context.Context
+	c     pg.Cluster
+	size  *prometheus.Desc
+	count *prometheus.Desc
+}
+
+func newSnapshotCollector(ctx context.Context, hostname string, c pg.Cluster) *snapshotCollector {
+	labels := map[string]string{hostnameLabel: hostname}
+	return &snapshotCollector{
+		ctx: ctx,
+		c:   c,
+		size: prometheus.NewDesc(
+			QualifiedMetricName(SnapshotsSize),
+			"disk space used by the data directory snapshots in bytes",
+			nil,
+			labels),
+		count: prometheus.NewDesc(
+			QualifiedMetricName(Snapshots),
+			"number of the data directory snapshots",
+			nil,
+			labels),
+	}
+}
+
+func (c *snapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.size
+	ch <- c.count
+}
+
+func (c *snapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	r, err := c.c.Snapshots(c.ctx)
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, float64(pg.SnapshotsSize(r)))
+	ch <- prometheus.MustNewConstMetric(c.count, prometheus.GaugeValue, float64(len(r)))
+}
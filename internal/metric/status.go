@@ -0,0 +1,121 @@
+package metric
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vontikov/pgcluster/internal/sentinel"
+)
+
+var (
+	states = []sentinel.ClusterState{sentinel.Detached, sentinel.Master, sentinel.Replica}
+	steps  = []string{sentinel.EscalationUnhealthy, sentinel.EscalationStop, sentinel.EscalationExit}
+)
+
+type statusCollector struct {
+	s            *sentinel.Sentinel
+	state        *prometheus.Desc
+	lastCheckAge *prometheus.Desc
+	checkSuccess *prometheus.Desc
+	checkErrors  *prometheus.Desc
+	lastError    *prometheus.Desc
+
+	consecutiveErrors *prometheus.Desc
+	unhealthy         *prometheus.Desc
+	escalations       *prometheus.Desc
+}
+
+func newStatusCollector(hostname string, s *sentinel.Sentinel) *statusCollector {
+	labels := map[string]string{hostnameLabel: hostname}
+	return &statusCollector{
+		s: s,
+		state: prometheus.NewDesc(
+			QualifiedMetricName(State),
+			"1 for the current sentinel state, 0 otherwise",
+			[]string{stateLabel},
+			labels),
+		lastCheckAge: prometheus.NewDesc(
+			QualifiedMetricName(LastCheckAge),
+			"seconds since the last sentinel check",
+			nil,
+			labels),
+		checkSuccess: prometheus.NewDesc(
+			QualifiedMetricName(CheckSuccess),
+			"number of successful sentinel checks",
+			nil,
+			labels),
+		checkErrors: prometheus.NewDesc(
+			QualifiedMetricName(CheckErrors),
+			"number of failed sentinel checks",
+			nil,
+			labels),
+		lastError: prometheus.NewDesc(
+			QualifiedMetricName(LastErrorTimestamp),
+			"unix time of the last sentinel check error",
+			nil,
+			labels),
+		consecutiveErrors: prometheus.NewDesc(
+			QualifiedMetricName(ConsecutiveErrors),
+			"number of consecutive failed sentinel checks",
+			nil,
+			labels),
+		unhealthy: prometheus.NewDesc(
+			QualifiedMetricName(Unhealthy),
+			"1 if the node is marked unhealthy, 0 otherwise",
+			nil,
+			labels),
+		escalations: prometheus.NewDesc(
+			QualifiedMetricName(Escalations),
+			"number of times the escalation step has been applied",
+			[]string{stepLabel},
+			labels),
+	}
+}
+
+func (c *statusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.state
+	ch <- c.lastCheckAge
+	ch <- c.checkSuccess
+	ch <- c.checkErrors
+	ch <- c.lastError
+	ch <- c.consecutiveErrors
+	ch <- c.unhealthy
+	ch <- c.escalations
+}
+
+func (c *statusCollector) Collect(ch chan<- prometheus.Metric) {
+	st := c.s.Status()
+
+	for _, s := range states {
+		v := 0.0
+		if s.String() == st.State {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, v, s.String())
+	}
+
+	if !st.LastCheck.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastCheckAge, prometheus.GaugeValue,
+			time.Since(st.LastCheck).Seconds())
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.checkSuccess, prometheus.CounterValue, float64(st.CheckSuccess))
+	ch <- prometheus.MustNewConstMetric(c.checkErrors, prometheus.CounterValue, float64(st.CheckErrors))
+
+	if st.LastErrorAt != nil {
+		// the message is returned by the status endpoint, not to blow up the
+		// label cardinality
+		ch <- prometheus.MustNewConstMetric(c.lastError, prometheus.GaugeValue,
+			float64(st.LastErrorAt.Unix()))
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.consecutiveErrors, prometheus.GaugeValue, float64(st.ConsecutiveErrors))
+	unhealthy := 0.0
+	if st.Unhealthy {
+		unhealthy = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.unhealthy, prometheus.GaugeValue, unhealthy)
+	for _, s := range steps {
+		ch <- prometheus.MustNewConstMetric(c.escalations, prometheus.CounterValue, float64(st.Escalations[s]), s)
+	}
+}
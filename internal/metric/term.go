@@ -0,0 +1,30 @@
+package metric
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vontikov/pgcluster/internal/sentinel"
+)
+
+type termCollector struct {
+	s *sentinel.Sentinel
+	d *prometheus.Desc
+}
+
+func newTermCollector(hostname string, s *sentinel.Sentinel) *termCollector {
+	return &termCollector{
+		s: s,
+		d: prometheus.NewDesc(
+			QualifiedMetricName(Term),
+			"failover term known to the node",
+			nil,
+			map[string]string{hostnameLabel: hostname}),
+	}
+}
+
+func (c *termCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.d
+}
+
+func (c *termCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.d, prometheus.GaugeValue, float64(c.s.Term()))
+}
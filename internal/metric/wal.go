@@ -0,0 +1,63 @@
+package metric
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vontikov/pgcluster/internal/pg"
+)
+
+type walCollector struct {
+	ctx             context.Context
+	c               pg.Cluster
+	lsn             *prometheus.Desc
+	replayLag       *prometheus.Desc
+	replayTimestamp *prometheus.Desc
+}
+
+func newWalCollector(ctx context.Context, hostname string, c pg.Cluster) *walCollector {
+	labels := map[string]string{hostnameLabel: hostname}
+	return &walCollector{
+		ctx: ctx,
+		c:   c,
+		lsn: prometheus.NewDesc(
+			QualifiedMetricName(WalLSN),
+			"WAL position in bytes",
+			[]string{positionLabel},
+			labels),
+		replayLag: prometheus.NewDesc(
+			QualifiedMetricName(WalReplayLagBytes),
+			"WAL received but not replayed yet in bytes",
+			nil,
+			labels),
+		replayTimestamp: prometheus.NewDesc(
+			QualifiedMetricName(WalReplayTimestamp),
+			"unix time of the last transaction replayed",
+			nil,
+			labels),
+	}
+}
+
+func (c *walCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lsn
+	ch <- c.replayLag
+	ch <- c.replayTimestamp
+}
+
+func (c *walCollector) Collect(ch chan<- prometheus.Metric) {
+	p, err := c.c.WalPosition(c.ctx)
+	if err != nil {
+		return
+	}
+	if p.Current != pg.InvalidLSN {
+		ch <- prometheus.MustNewConstMetric(c.lsn, prometheus.GaugeValue, float64(p.Current), "current")
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.lsn, prometheus.GaugeValue, float64(p.Received), "received")
+	ch <- prometheus.MustNewConstMetric(c.lsn, prometheus.GaugeValue, float64(p.Replayed), "replayed")
+	ch <- prometheus.MustNewConstMetric(c.replayLag, prometheus.GaugeValue, float64(p.ReplayLag()))
+	if p.ReplayTimestamp != nil {
+		ch <- prometheus.MustNewConstMetric(c.replayTimestamp, prometheus.GaugeValue,
+			float64(p.ReplayTimestamp.UnixNano())/1e9)
+	}
+}
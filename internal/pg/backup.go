@@ -0,0 +1,187 @@
+package pg
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/env"
+)
+
+// Backup job statuses.
+const (
+	BackupJobRunning   = "running"
+	BackupJobSucceeded = "succeeded"
+	BackupJobFailed    = "failed"
+)
+
+var (
+	// ErrBackupInProgress is returned when a backup job is started while
+	// another one is running.
+	ErrBackupInProgress = errors.New("backup in progress")
+
+	// ErrNotStandby is returned when a backup job is started on the master.
+	ErrNotStandby = errors.New("not a standby")
+)
+
+// BackupJob describes a reinitialisation of the node from a host:port.
+type BackupJob struct {
+	ID         string     `json:"id"`
+	Host       string     `json:"host"`
+	Port       int        `json:"port"`
+	Status     string     `json:"status"`
+	Progress   int        `json:"progress"`
+	DoneKB     int64      `json:"done_kb"`
+	TotalKB    int64      `json:"total_kb"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// StartBackupJob implements Cluster.StartBackupJob().
+func (c *cluster) StartBackupJob(ctx context.Context, host string, port int, ready func()) (*BackupJob, error) {
+	// a standby which is not running may be reinitialised
+	if r, err := c.InRecovery(ctx); err == nil && !r {
+		return nil, ErrNotStandby
+	}
+	id, err := jobID()
+	if err != nil {
+		return nil, err
+	}
+
+	c.jmu.Lock()
+	if c.job != nil && c.job.Status == BackupJobRunning {
+		c.jmu.Unlock()
+		return nil, ErrBackupInProgress
+	}
+	c.job = &BackupJob{
+		ID:        id,
+		Host:      host,
+		Port:      port,
+		Status:    BackupJobRunning,
+		StartedAt: time.Now(),
+	}
+	r := *c.job
+	c.jmu.Unlock()
+
+	c.logger.Warn("backup job started", "id", id, "host", host, "port", port)
+	go c.runBackupJob(host, port, ready)
+	return &r, nil
+}
+
+// BackupJob implements Cluster.BackupJob().
+func (c *cluster) BackupJob(context.Context) *BackupJob {
+	c.jmu.Lock()
+	defer c.jmu.Unlock()
+	if c.job == nil {
+		return nil
+	}
+	r := *c.job
+	return &r
+}
+
+func (c *cluster) runBackupJob(host string, port int, ready func()) {
+	if ready != nil {
+		ready()
+	}
+	err := c.reinit(c.ctx, host, port)
+
+	c.jmu.Lock()
+	defer c.jmu.Unlock()
+	now := time.Now()
+	c.job.FinishedAt = &now
+	if err != nil {
+		c.job.Status = BackupJobFailed
+		c.job.Error = err.Error()
+		c.logger.Error("backup job failed", "id", c.job.ID, "message", err)
+		return
+	}
+	c.job.Status = BackupJobSucceeded
+	c.job.Progress = 100
+	c.logger.Info("backup job succeeded", "id", c.job.ID)
+}
+
+// reinit stops the node, backs it up from the host:port and starts it again.
+func (c *cluster) reinit(ctx context.Context, host string, port int) error {
+	if err := c.Stop(ctx); err != nil {
+		// pg_ctl fails if the server is not running
+		dataDir, derr := env.Get(env.PgData)
+		if derr != nil {
+			return derr
+		}
+		if pid, perr := postmasterPid(dataDir); perr == nil && postmasterRunning(dataDir, pid) {
+			return err
+		}
+	}
+	if err := c.backup(ctx, host, port, c.backupProgress); err != nil {
+		return err
+	}
+	return c.Start(ctx)
+}
+
+func (c *cluster) backupProgress(done, total int64) {
+	c.jmu.Lock()
+	defer c.jmu.Unlock()
+	if c.job == nil {
+		return
+	}
+	c.job.DoneKB = done
+	c.job.TotalKB = total
+	if total > 0 {
+		c.job.Progress = int(done * 100 / total)
+	}
+}
+
+func jobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// progressRegexp matches the pg_basebackup -P progress, e.g.
+// "12345/67890 kB (18%), 0/1 tablespace".
+var progressRegexp = regexp.MustCompile(`(\d+)/(\d+) kB \(\d+%\)`)
+
+// progressWriter parses the pg_basebackup -P output. The progress lines are
+// terminated with carriage returns when the output is a terminal, and with
+// new lines when it is not.
+type progressWriter struct {
+	f   func(done, total int64)
+	buf []byte
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		w.parse(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *progressWriter) parse(line []byte) {
+	m := progressRegexp.FindSubmatch(line)
+	if m == nil {
+		return
+	}
+	done, err := strconv.ParseInt(string(m[1]), 10, 64)
+	if err != nil {
+		return
+	}
+	total, err := strconv.ParseInt(string(m[2]), 10, 64)
+	if err != nil {
+		return
+	}
+	w.f(done, total)
+}
@@ -0,0 +1,129 @@
+package pg
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vontikov/pgcluster/internal/env"
+	"github.com/vontikov/pgcluster/internal/logging"
+)
+
+func TestProgressWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	type progress struct{ done, total int64 }
+	var r []progress
+	w := &progressWriter{f: func(done, total int64) { r = append(r, progress{done, total}) }}
+
+	out := []string{
+		"pg_basebackup: initiating base backup, waiting for checkpoint to complete\n",
+		"     0/24340 kB (0%), 0/1 tablespace\r",
+		"12170/24340 kB (50%), 0/1 tab",
+		"lespace\r24350/24350 kB (100%), 1/1 tablespace\n",
+		"pg_basebackup: base backup completed\n",
+	}
+	for _, s := range out {
+		n, err := w.Write([]byte(s))
+		assert.Nil(err)
+		assert.Equal(len(s), n)
+	}
+	assert.Equal([]progress{{0, 24340}, {12170, 24340}, {24350, 24350}}, r)
+}
+
+func TestStartBackupJobInProgress(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &cluster{logger: logging.NewLogger("test")}
+	c.job = &BackupJob{ID: "1", Status: BackupJobRunning}
+
+	_, err := c.StartBackupJob(context.Background(), "master", DefaultPort, nil)
+	assert.ErrorIs(err, ErrBackupInProgress)
+
+	c.backupProgress(512, 1024)
+	job := c.BackupJob(context.Background())
+	assert.Equal("1", job.ID)
+	assert.Equal(50, job.Progress)
+	assert.Equal(int64(1024), job.TotalKB)
+
+	// a copy is returned
+	job.Status = BackupJobFailed
+	assert.Equal(BackupJobRunning, c.BackupJob(context.Background()).Status)
+}
+
+// fakeBasebackup fails while the fail file exists, like pg_basebackup which
+// removes the data directory it has created, and writes PG_VERSION otherwise.
+const fakeBasebackup = `#!/bin/sh
+while [ $# -gt 0 ]; do
+  [ "$1" = "-D" ] && dir="$2"
+  shift
+done
+[ -e "$(dirname "$0")/fail" ] && exit 1
+mkdir -p "$dir" && echo 13 > "$dir/PG_VERSION"
+`
+
+func TestBackupRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "backup")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	binDir := filepath.Join(dir, "bin")
+	dataDir := filepath.Join(dir, "data")
+	backupRoot := filepath.Join(dir, "backup")
+	assert.Nil(os.Mkdir(binDir, 0700))
+	assert.Nil(os.Mkdir(dataDir, 0700))
+	assert.Nil(os.Mkdir(backupRoot, 0700))
+	assert.Nil(ioutil.WriteFile(filepath.Join(binDir, "pg_basebackup"), []byte(fakeBasebackup), 0700))
+	assert.Nil(ioutil.WriteFile(filepath.Join(binDir, "fail"), nil, 0600))
+	assert.Nil(ioutil.WriteFile(filepath.Join(dataDir, "PG_VERSION"), []byte("13\n"), 0600))
+
+	for k, v := range map[string]string{
+		"PATH":                binDir + string(os.PathListSeparator) + os.Getenv("PATH"),
+		env.PgData:            dataDir,
+		env.PgBackup:          backupRoot,
+		env.PgReplicationUser: "replicator",
+	} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := New(ctx).(*cluster)
+
+	// the master is not reachable, the data directory is moved aside
+	assert.NotNil(c.backup(ctx, "master", DefaultPort, nil))
+	_, err = os.Stat(dataDir)
+	assert.True(os.IsNotExist(err))
+	r, err := c.Snapshots(ctx)
+	assert.Nil(err)
+	assert.Len(r, 1)
+
+	// the disk space is freed before the backup, even if it fails
+	older := time.Now().Add(-time.Hour).Format(snapshotLayout)
+	assert.Nil(os.Mkdir(filepath.Join(backupRoot, older), 0700))
+	c.snapshotMinFree = math.MaxUint64
+	assert.NotNil(c.backup(ctx, "master", DefaultPort, nil))
+	r, err = c.Snapshots(ctx)
+	assert.Nil(err)
+	assert.Len(r, 1)
+	assert.NotEqual(older, r[0].Name)
+	c.snapshotMinFree = 0
+
+	// retried without the data directory
+	assert.Nil(os.Remove(filepath.Join(binDir, "fail")))
+	assert.Nil(c.backup(ctx, "master", DefaultPort, nil))
+	_, err = os.Stat(filepath.Join(dataDir, "PG_VERSION"))
+	assert.Nil(err)
+	r, err = c.Snapshots(ctx)
+	assert.Nil(err)
+	assert.Len(r, 1)
+}
@@ -0,0 +1,143 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vontikov/pgcluster/internal/env"
+)
+
+// MinSupportedVersion is the earliest supported major version.
+const MinSupportedVersion = 10
+
+// Capabilities describes the features of a PostgreSQL major version the agent
+// depends on.
+type Capabilities struct {
+	// Major is the server major version.
+	Major int `json:"major"`
+
+	// StandbySignal is true if a standby is configured with standby.signal
+	// and the server parameters, false if with recovery.conf.
+	StandbySignal bool `json:"standby_signal"`
+
+	// PgPromote is true if pg_promote() is available.
+	PgPromote bool `json:"pg_promote"`
+
+	// PromoteTriggerFile is true if the promote_trigger_file parameter is
+	// available.
+	PromoteTriggerFile bool `json:"promote_trigger_file"`
+
+	// WalKeepSize is true if the WAL retained for standbys is set by
+	// wal_keep_size, false if by wal_keep_segments.
+	WalKeepSize bool `json:"wal_keep_size"`
+
+	// PrimarySlotName is true if primary_slot_name is a server parameter,
+	// false if it is a recovery.conf setting.
+	PrimarySlotName bool `json:"primary_slot_name"`
+
+	// RewindWriteRecoveryConf is true if pg_rewind is able to configure the
+	// standby with --write-recovery-conf.
+	RewindWriteRecoveryConf bool `json:"rewind_write_recovery_conf"`
+}
+
+// CapabilitiesOf returns the capabilities of the major version.
+func CapabilitiesOf(major int) *Capabilities {
+	return &Capabilities{
+		Major:                   major,
+		StandbySignal:           major >= 12,
+		PgPromote:               major >= 12,
+		PromoteTriggerFile:      major < 16,
+		WalKeepSize:             major >= 13,
+		PrimarySlotName:         major >= 12,
+		RewindWriteRecoveryConf: major >= 13,
+	}
+}
+
+// Capabilities implements Cluster.Capabilities().
+func (c *cluster) Capabilities(ctx context.Context) (*Capabilities, error) {
+	c.mu.Lock()
+	caps := c.caps
+	c.mu.Unlock()
+	if caps != nil {
+		return caps, nil
+	}
+
+	// the server may be stopped, e.g. to be rewound
+	major, err := dataDirVersion()
+	if err != nil {
+		if major, _, err = c.Version(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if major < MinSupportedVersion {
+		c.logger.Warn("unsupported version", "major", major, "min", MinSupportedVersion)
+	}
+
+	caps = CapabilitiesOf(major)
+	c.mu.Lock()
+	c.caps = caps
+	c.mu.Unlock()
+	return caps, nil
+}
+
+// dataDirVersion returns the major version from PG_VERSION of the data
+// directory.
+func dataDirVersion() (int, error) {
+	dataDir, err := env.Get(env.PgData)
+	if err != nil {
+		return 0, err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dataDir, "PG_VERSION"))
+	if err != nil {
+		return 0, err
+	}
+	v := strings.TrimSpace(string(b))
+	// e.g. 9.6 prior to 10
+	return strconv.Atoi(strings.SplitN(v, ".", 2)[0])
+}
+
+// writeStandbyConfig configures the stopped standby to follow the host:port
+// the way the version does.
+func (c *cluster) writeStandbyConfig(caps *Capabilities, host string, port int) error {
+	user, err := env.Get(env.PgReplicationUser)
+	if err != nil {
+		return err
+	}
+	dataDir, err := env.Get(env.PgData)
+	if err != nil {
+		return err
+	}
+	conninfo := fmt.Sprintf("primary_conninfo = 'host=%s port=%d user=%s'", host, port, user)
+
+	if !caps.StandbySignal {
+		conf := []string{
+			"standby_mode = 'on'",
+			conninfo,
+			"recovery_target_timeline = 'latest'",
+			fmt.Sprintf("trigger_file = '%s'", ReplicationPromoteTriggerFile),
+			"",
+		}
+		if err := ioutil.WriteFile(filepath.Join(dataDir, "recovery.conf"), []byte(strings.Join(conf, "\n")), 0600); err != nil {
+			return err
+		}
+		return c.writePrimarySlotName(caps)
+	}
+
+	if err := setParameter(filepath.Join(dataDir, "postgresql.auto.conf"), "primary_conninfo", conninfo); err != nil {
+		return err
+	}
+	if err := c.writePrimarySlotName(caps); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dataDir, "standby.signal"), os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,70 @@
+package pg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vontikov/pgcluster/internal/env"
+	"github.com/vontikov/pgcluster/internal/logging"
+)
+
+func TestCapabilitiesOf(t *testing.T) {
+	assert := assert.New(t)
+
+	c := CapabilitiesOf(10)
+	assert.False(c.StandbySignal)
+	assert.False(c.PgPromote)
+	assert.True(c.PromoteTriggerFile)
+	assert.False(c.WalKeepSize)
+	assert.False(c.PrimarySlotName)
+	assert.False(c.RewindWriteRecoveryConf)
+
+	c = CapabilitiesOf(12)
+	assert.True(c.StandbySignal)
+	assert.True(c.PgPromote)
+	assert.False(c.WalKeepSize)
+	assert.False(c.RewindWriteRecoveryConf)
+
+	c = CapabilitiesOf(13)
+	assert.True(c.WalKeepSize)
+	assert.True(c.RewindWriteRecoveryConf)
+
+	c = CapabilitiesOf(17)
+	assert.True(c.StandbySignal)
+	assert.False(c.PromoteTriggerFile)
+}
+
+func TestWriteStandbyConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "pgdata")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	defer os.Setenv(env.PgData, os.Getenv(env.PgData))
+	defer os.Setenv(env.PgReplicationUser, os.Getenv(env.PgReplicationUser))
+	os.Setenv(env.PgData, dir)
+	os.Setenv(env.PgReplicationUser, "replicator")
+
+	c := &cluster{logger: logging.NewLogger("test")}
+
+	// recovery.conf
+	assert.Nil(c.writeStandbyConfig(CapabilitiesOf(11), "master", 5432))
+	b, err := ioutil.ReadFile(filepath.Join(dir, "recovery.conf"))
+	assert.Nil(err)
+	assert.Contains(string(b), "standby_mode = 'on'")
+	assert.Contains(string(b), "primary_conninfo = 'host=master port=5432 user=replicator'")
+
+	// standby.signal
+	auto := filepath.Join(dir, "postgresql.auto.conf")
+	assert.Nil(ioutil.WriteFile(auto, []byte("wal_level = 'replica'\nprimary_conninfo = 'host=old'\n"), 0600))
+	assert.Nil(c.writeStandbyConfig(CapabilitiesOf(13), "master", 5432))
+	b, err = ioutil.ReadFile(auto)
+	assert.Nil(err)
+	assert.Equal("wal_level = 'replica'\nprimary_conninfo = 'host=master port=5432 user=replicator'\n", string(b))
+	_, err = os.Stat(filepath.Join(dir, "standby.signal"))
+	assert.Nil(err)
+}
@@ -0,0 +1,149 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ErrInvalidParameter is returned when a parameter name is not valid.
+var ErrInvalidParameter = errors.New("invalid parameter")
+
+var parameterNameRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// ParameterError is returned by AlterSystem when some of the parameters fail
+// to be set or reset.
+type ParameterError struct {
+	// Errors are the errors by the parameter name.
+	Errors map[string]error
+}
+
+func (e *ParameterError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := make([]string, 0, len(names))
+	for _, name := range names {
+		errs = append(errs, fmt.Sprintf("%s: %v", name, e.Errors[name]))
+	}
+	return strings.Join(errs, "; ")
+}
+
+// ValidParameterName returns true if the name is a valid parameter name, e.g.
+// work_mem or auto_explain.log_min_duration.
+func ValidParameterName(name string) bool {
+	return parameterNameRegexp.MatchString(name)
+}
+
+// AlterSystem implements Cluster.AlterSystem().
+func (c *cluster) AlterSystem(ctx context.Context, set map[string]string, reset []string) (err error) {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range append(names, reset...) {
+		if !ValidParameterName(name) {
+			return fmt.Errorf("%w: %q", ErrInvalidParameter, name)
+		}
+	}
+
+	c.logger.Info("altering system", "set", set, "reset", reset)
+
+	// apply as much as possible, e.g. an unknown parameter does not prevent
+	// the others from being set
+	errs := make(map[string]error)
+	err = c.withConn(ctx, func(ctx context.Context, conn *pgxpool.Conn) error {
+		for _, name := range names {
+			sql := fmt.Sprintf("ALTER SYSTEM SET %s = %s", name, quoteLiteral(set[name]))
+			if _, err := conn.Exec(ctx, sql); err != nil {
+				errs[name] = err
+			}
+		}
+		for _, name := range reset {
+			if _, err := conn.Exec(ctx, "ALTER SYSTEM RESET "+name); err != nil {
+				errs[name] = err
+			}
+		}
+		_, err := conn.Exec(ctx, "SELECT pg_reload_conf()")
+		return err
+	})
+	if err != nil {
+		return
+	}
+	if len(errs) > 0 {
+		return &ParameterError{Errors: errs}
+	}
+	return
+}
+
+// SystemSettings implements Cluster.SystemSettings().
+func (c *cluster) SystemSettings(ctx context.Context) (r map[string]string, err error) {
+	// the latest occurrence takes effect
+	const sql = `
+SELECT name, setting FROM pg_file_settings
+WHERE sourcefile LIKE '%/postgresql.auto.conf'
+ORDER BY seqno`
+
+	err = c.withConn(ctx, func(ctx context.Context, conn *pgxpool.Conn) error {
+		rows, err := conn.Query(ctx, sql)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		r = make(map[string]string)
+		for rows.Next() {
+			var name, setting string
+			if err := rows.Scan(&name, &setting); err != nil {
+				return err
+			}
+			r[name] = setting
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// PendingRestart implements Cluster.PendingRestart().
+func (c *cluster) PendingRestart(ctx context.Context) (r []string, err error) {
+	const sql = "SELECT name FROM pg_settings WHERE pending_restart ORDER BY name"
+
+	err = c.withConn(ctx, func(ctx context.Context, conn *pgxpool.Conn) error {
+		rows, err := conn.Query(ctx, sql)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		r = []string{}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			r = append(r, name)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// quoteLiteral quotes the string as an SQL literal. Backslashes are not
+// escapes, standard_conforming_strings is on.
+func quoteLiteral(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+}
@@ -0,0 +1,37 @@
+package pg
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidParameterName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(ValidParameterName("work_mem"))
+	assert.True(ValidParameterName("auto_explain.log_min_duration"))
+	assert.False(ValidParameterName(""))
+	assert.False(ValidParameterName("Work_Mem"))
+	assert.False(ValidParameterName("work_mem = 1; DROP TABLE t"))
+	assert.False(ValidParameterName("a.b.c"))
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(`'4MB'`, quoteLiteral("4MB"))
+	assert.Equal(`'it''s'`, quoteLiteral("it's"))
+	assert.Equal(`'C:\dir'`, quoteLiteral(`C:\dir`))
+}
+
+func TestParameterError(t *testing.T) {
+	assert := assert.New(t)
+
+	err := &ParameterError{Errors: map[string]error{
+		"work_mem": errors.New("invalid value"),
+		"no_such":  errors.New("unrecognized"),
+	}}
+	assert.Equal("no_such: unrecognized; work_mem: invalid value", err.Error())
+}
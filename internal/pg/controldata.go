@@ -0,0 +1,119 @@
+package pg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/vontikov/pgcluster/internal/env"
+)
+
+// StateShutDown is the database cluster state of the master shut down
+// cleanly.
+const StateShutDown = "shut down"
+
+// ControlData contains the pg_control data of Cluster.
+type ControlData struct {
+	// SystemIdentifier is the unique identifier of the database cluster,
+	// shared by the master and its standbys.
+	SystemIdentifier uint64 `json:"system_identifier,string"`
+	// Timeline is the timeline ID of the latest checkpoint.
+	Timeline int `json:"timeline"`
+	// CheckpointLSN is the location of the latest checkpoint.
+	CheckpointLSN LSN `json:"checkpoint_lsn"`
+	// State is the database cluster state, available from pg_controldata
+	// only.
+	State string `json:"state,omitempty"`
+}
+
+// ControlData implements Cluster.ControlData(). It runs pg_controldata, which
+// works even if the server is stopped, and falls back to the control
+// functions.
+func (c *cluster) ControlData(ctx context.Context) (*ControlData, error) {
+	cd, err := c.controlDataCommand(ctx)
+	if err == nil {
+		return cd, nil
+	}
+	c.logger.Debug("pg_controldata error, querying", "message", err)
+	return c.controlDataQuery(ctx)
+}
+
+func (c *cluster) controlDataCommand(ctx context.Context) (*ControlData, error) {
+	dir, err := env.Get(env.PgBinDir)
+	if err != nil {
+		return nil, err
+	}
+	dataDir, err := env.Get(env.PgData)
+	if err != nil {
+		return nil, err
+	}
+
+	/* #nosec */
+	cmd := exec.CommandContext(ctx, fmt.Sprintf("%s/pg_controldata", dir), "-D", dataDir)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseControlData(string(out))
+}
+
+// parseControlData parses the pg_controldata output.
+func parseControlData(out string) (*ControlData, error) {
+	var cd ControlData
+	var found int
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		kv := strings.SplitN(sc.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v := strings.TrimSpace(kv[1])
+
+		var err error
+		switch strings.TrimSpace(kv[0]) {
+		case "Database system identifier":
+			cd.SystemIdentifier, err = strconv.ParseUint(v, 10, 64)
+			found++
+		case "Latest checkpoint's TimeLineID":
+			cd.Timeline, err = strconv.Atoi(v)
+			found++
+		case "Latest checkpoint location":
+			cd.CheckpointLSN, err = ParseLSN(v)
+			found++
+		case "Database cluster state":
+			cd.State = v
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid pg_controldata output: %w", err)
+		}
+	}
+	if found != 3 {
+		return nil, fmt.Errorf("invalid pg_controldata output: %d of 3 fields found", found)
+	}
+	return &cd, nil
+}
+
+func (c *cluster) controlDataQuery(ctx context.Context) (cd *ControlData, err error) {
+	const sql = `
+SELECT s.system_identifier::text, k.timeline_id, k.checkpoint_lsn::text
+FROM pg_control_system() s, pg_control_checkpoint() k`
+
+	var id, lsn string
+	cd = &ControlData{}
+	if err = c.queryRow(ctx, sql, &id, &cd.Timeline, &lsn); err != nil {
+		return nil, err
+	}
+	if cd.SystemIdentifier, err = strconv.ParseUint(id, 10, 64); err != nil {
+		return nil, err
+	}
+	if cd.CheckpointLSN, err = ParseLSN(lsn); err != nil {
+		return nil, err
+	}
+	return
+}
@@ -0,0 +1,33 @@
+package pg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const controlDataOutput = `pg_control version number:            1300
+Catalog version number:               202007201
+Database system identifier:           6960000000000000001
+Database cluster state:               in production
+pg_control last modified:             Thu 20 May 2021 10:00:00 AM UTC
+Latest checkpoint location:           0/3000060
+Latest checkpoint's REDO location:    0/3000028
+Latest checkpoint's REDO WAL file:    000000020000000000000003
+Latest checkpoint's TimeLineID:       2
+Latest checkpoint's PrevTimeLineID:   2
+`
+
+func TestParseControlData(t *testing.T) {
+	assert := assert.New(t)
+
+	cd, err := parseControlData(controlDataOutput)
+	assert.Nil(err)
+	assert.Equal(uint64(6960000000000000001), cd.SystemIdentifier)
+	assert.Equal(2, cd.Timeline)
+	assert.Equal(LSN(0x3000060), cd.CheckpointLSN)
+	assert.Equal("in production", cd.State)
+
+	_, err = parseControlData("Database system identifier: 1\n")
+	assert.NotNil(err)
+}
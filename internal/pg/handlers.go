@@ -1,27 +1,33 @@
 package pg
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 )
 
 func Handlers(c Cluster) map[string]func(http.ResponseWriter, *http.Request) {
 	return map[string]func(http.ResponseWriter, *http.Request){
-		"/pg/version":    versionHandler(c),
-		"/pg/alive":      aliveHandler(c),
-		"/pg/inrecovery": inrecoveryHandler(c),
-		"/pg/masterinfo": masterinfoHandler(c),
-		"/pg/stop":       stopHandler(c),
-		"/pg/start":      startHandler(c),
-		"/pg/promote":    promoteHandler(c),
-		"/pg/backup":     backupHandler(c),
+		"/pg/version":     versionHandler(c),
+		"/pg/alive":       aliveHandler(c),
+		"/pg/inrecovery":  inrecoveryHandler(c),
+		"/pg/masterinfo":  masterinfoHandler(c),
+		"/pg/replication": replicationHandler(c),
+		"/pg/slots":       slotsHandler(c),
+		"/pg/wal":         walHandler(c),
+		"/pg/controldata": controldataHandler(c),
+		"/pg/snapshots":   snapshotsHandler(c),
+		"/pg/stop":        stopHandler(c),
+		"/pg/start":       startHandler(c),
+		"/pg/promote":     promoteHandler(c),
 	}
 }
 
 func versionHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
-	return getFunc(func() ([]byte, error) {
-		major, minor, err := c.Version()
+	return getFunc(func(ctx context.Context) ([]byte, error) {
+		major, minor, err := c.Version(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -30,8 +36,8 @@ func versionHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
 }
 
 func aliveHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
-	return getFunc(func() ([]byte, error) {
-		alive, err := c.Alive()
+	return getFunc(func(ctx context.Context) ([]byte, error) {
+		alive, err := c.Alive(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -40,8 +46,8 @@ func aliveHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
 }
 
 func inrecoveryHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
-	return getFunc(func() ([]byte, error) {
-		inrecovery, err := c.InRecovery()
+	return getFunc(func(ctx context.Context) ([]byte, error) {
+		inrecovery, err := c.InRecovery(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -50,8 +56,8 @@ func inrecoveryHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
 }
 
 func masterinfoHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
-	return getFunc(func() ([]byte, error) {
-		mi, err := c.MasterInfo()
+	return getFunc(func(ctx context.Context) ([]byte, error) {
+		mi, err := c.MasterInfo(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -63,6 +69,74 @@ func masterinfoHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
 	})
 }
 
+func replicationHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
+	return getFunc(func(ctx context.Context) ([]byte, error) {
+		r, err := c.ReplicationStatus(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(r)
+	})
+}
+
+func slotsHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
+	return getFunc(func(ctx context.Context) ([]byte, error) {
+		r, err := c.ReplicationSlots(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(r)
+	})
+}
+
+func walHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
+	return getFunc(func(ctx context.Context) ([]byte, error) {
+		p, err := c.WalPosition(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(p)
+	})
+}
+
+func controldataHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
+	return getFunc(func(ctx context.Context) ([]byte, error) {
+		cd, err := c.ControlData(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(cd)
+	})
+}
+
+func snapshotsHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
+	list := getFunc(func(ctx context.Context) ([]byte, error) {
+		r, err := c.Snapshots(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(r)
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			list(w, r)
+			return
+		}
+		if err := c.DeleteSnapshot(r.Context(), r.URL.Query().Get("name")); err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, ErrSnapshotNotFound) {
+				code = http.StatusNotFound
+			}
+			if errors.Is(err, ErrBackupInProgress) {
+				code = http.StatusConflict
+			}
+			writeStatus(w, code, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 func stopHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
 	return postFunc(c.Stop)
 }
@@ -75,14 +149,16 @@ func promoteHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
 	return postFunc(c.Promote)
 }
 
-func backupHandler(c Cluster) func(http.ResponseWriter, *http.Request) {
-	return func(http.ResponseWriter, *http.Request) {
-		// TODO
-		panic("backupHandler() not implemented yet")
+func writeStatus(w http.ResponseWriter, code int, err error) {
+	w.WriteHeader(code)
+	if err == nil {
+		w.Write([]byte(http.StatusText(code)))
+		return
 	}
+	w.Write([]byte(fmt.Sprintf("%s: %s", http.StatusText(code), err.Error())))
 }
 
-func getFunc(f func() ([]byte, error)) func(http.ResponseWriter, *http.Request) {
+func getFunc(f func(context.Context) ([]byte, error)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -90,7 +166,7 @@ func getFunc(f func() ([]byte, error)) func(http.ResponseWriter, *http.Request)
 			return
 		}
 
-		b, err := f()
+		b, err := f(r.Context())
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error())))
@@ -103,7 +179,7 @@ func getFunc(f func() ([]byte, error)) func(http.ResponseWriter, *http.Request)
 	}
 }
 
-func postFunc(f func() error) func(http.ResponseWriter, *http.Request) {
+func postFunc(f func(context.Context) error) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -111,7 +187,7 @@ func postFunc(f func() error) func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		if err := f(); err != nil {
+		if err := f(r.Context()); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error())))
 			return
@@ -0,0 +1,205 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// hbaHeader is written at the beginning of the managed pg_hba.conf.
+	hbaHeader = "# Managed by pgcluster, changes are overwritten.\n"
+
+	// hbaReloadDelay is the time given to the postmaster to reload
+	// pg_hba.conf, pg_reload_conf() does not wait.
+	hbaReloadDelay = 500 * time.Millisecond
+)
+
+// ErrInvalidHBA is returned when the pg_hba.conf rules are not valid.
+var ErrInvalidHBA = errors.New("invalid pg_hba.conf")
+
+var hbaTypes = map[string]bool{
+	"local":        true,
+	"host":         true,
+	"hostssl":      true,
+	"hostnossl":    true,
+	"hostgssenc":   true,
+	"hostnogssenc": true,
+}
+
+// HBARule is a pg_hba.conf record. The address is empty for local records.
+type HBARule struct {
+	Type     string `json:"type"`
+	Database string `json:"database"`
+	User     string `json:"user"`
+	Address  string `json:"address,omitempty"`
+	Method   string `json:"method"`
+	Options  string `json:"options,omitempty"`
+}
+
+// Validate returns an error if the rule is not a well formed record. Whether
+// the values are valid is checked by PostgreSQL.
+func (r *HBARule) Validate() error {
+	if !hbaTypes[r.Type] {
+		return fmt.Errorf("%w: type %q", ErrInvalidHBA, r.Type)
+	}
+	fields := map[string]string{"database": r.Database, "user": r.User, "method": r.Method}
+	if r.Type != "local" {
+		fields["address"] = r.Address
+	} else if r.Address != "" {
+		return fmt.Errorf("%w: address of a local record", ErrInvalidHBA)
+	}
+	for k, v := range fields {
+		if v == "" || strings.ContainsAny(v, " \t\r\n#") {
+			return fmt.Errorf("%w: %s %q", ErrInvalidHBA, k, v)
+		}
+	}
+	if strings.ContainsAny(r.Options, "\r\n#") {
+		return fmt.Errorf("%w: options %q", ErrInvalidHBA, r.Options)
+	}
+	return nil
+}
+
+func (r *HBARule) String() string {
+	s := fmt.Sprintf("%-8s %-12s %-12s %-24s %s", r.Type, r.Database, r.User, r.Address, r.Method)
+	if r.Options != "" {
+		s += " " + r.Options
+	}
+	return s
+}
+
+// ParseHBARules parses the records in pg_hba.conf format separated by new lines
+// or semicolons. The addresses are in CIDR notation, the IP-mask form is not
+// supported.
+func ParseHBARules(v string) ([]*HBARule, error) {
+	var r []*HBARule
+	for _, l := range strings.FieldsFunc(v, func(c rune) bool { return c == '\n' || c == ';' }) {
+		if i := strings.IndexByte(l, '#'); i >= 0 {
+			l = l[:i]
+		}
+		f := strings.Fields(l)
+		if len(f) == 0 {
+			continue
+		}
+		n := 5
+		if f[0] == "local" {
+			n = 4
+		}
+		if len(f) < n {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidHBA, strings.TrimSpace(l))
+		}
+		rule := &HBARule{Type: f[0], Database: f[1], User: f[2], Method: f[n-1]}
+		if n == 5 {
+			rule.Address = f[3]
+		}
+		rule.Options = strings.Join(f[n:], " ")
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		r = append(r, rule)
+	}
+	return r, nil
+}
+
+// RenderHBA returns pg_hba.conf with the rules.
+func RenderHBA(rules []*HBARule) string {
+	var b strings.Builder
+	b.WriteString(hbaHeader)
+	for _, r := range rules {
+		b.WriteString(r.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// SetHBA implements Cluster.SetHBA().
+func (c *cluster) SetHBA(ctx context.Context, rules []*HBARule) error {
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	content := RenderHBA(rules)
+	return c.withConn(ctx, func(ctx context.Context, conn *pgxpool.Conn) error {
+		return c.setHBA(ctx, conn, content, len(rules))
+	})
+}
+
+func (c *cluster) setHBA(ctx context.Context, conn *pgxpool.Conn, content string, n int) (err error) {
+	const errorsSQL = `
+SELECT line_number, error FROM pg_hba_file_rules
+WHERE error IS NOT NULL
+ORDER BY line_number`
+
+	var path string
+	if err = conn.QueryRow(ctx, "SELECT current_setting('hba_file')").Scan(&path); err != nil {
+		return
+	}
+	prev, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if string(prev) == content {
+		return nil
+	}
+
+	c.logger.Warn("writing pg_hba.conf", "path", path, "rules", n)
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		return
+	}
+	restore := func(cause error) error {
+		c.logger.Error("restoring pg_hba.conf", "message", cause)
+		if err := ioutil.WriteFile(path, prev, 0600); err != nil {
+			return fmt.Errorf("%v, failed to restore: %w", cause, err)
+		}
+		// even if the context is done
+		ctx, cancel := context.WithTimeout(context.Background(), c.connectionTimeout)
+		defer cancel()
+		if _, err := conn.Exec(ctx, "SELECT pg_reload_conf()"); err != nil {
+			return fmt.Errorf("%v, failed to reload: %w", cause, err)
+		}
+		return cause
+	}
+
+	// pg_hba_file_rules reads the file on disk, not the loaded one
+	rows, err := conn.Query(ctx, errorsSQL)
+	if err != nil {
+		return restore(err)
+	}
+	var errs []string
+	for rows.Next() {
+		var line int
+		var msg string
+		if err = rows.Scan(&line, &msg); err != nil {
+			rows.Close()
+			return restore(err)
+		}
+		errs = append(errs, fmt.Sprintf("line %d: %s", line, msg))
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return restore(err)
+	}
+	if len(errs) > 0 {
+		return restore(fmt.Errorf("%w: %s", ErrInvalidHBA, strings.Join(errs, "; ")))
+	}
+
+	if _, err = conn.Exec(ctx, "SELECT pg_reload_conf()"); err != nil {
+		return restore(err)
+	}
+
+	// the pooled connections are authenticated already, make sure the agent
+	// is not locked out
+	time.Sleep(hbaReloadDelay)
+	check, err := pgx.Connect(ctx, c.connString())
+	if err != nil {
+		return restore(fmt.Errorf("%w: agent is not able to connect: %v", ErrInvalidHBA, err))
+	}
+	return check.Close(ctx)
+}
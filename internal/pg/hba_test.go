@@ -0,0 +1,58 @@
+package pg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHBARules(t *testing.T) {
+	assert := assert.New(t)
+
+	rules, err := ParseHBARules(`
+# local access
+local all        all                   peer
+host  replication replicator 10.0.0.0/8 md5 ; hostssl all all 0.0.0.0/0 cert clientcert=verify-full
+`)
+	assert.Nil(err)
+	assert.Equal([]*HBARule{
+		{Type: "local", Database: "all", User: "all", Method: "peer"},
+		{Type: "host", Database: "replication", User: "replicator", Address: "10.0.0.0/8", Method: "md5"},
+		{Type: "hostssl", Database: "all", User: "all", Address: "0.0.0.0/0", Method: "cert", Options: "clientcert=verify-full"},
+	}, rules)
+
+	rules, err = ParseHBARules("")
+	assert.Nil(err)
+	assert.Nil(rules)
+
+	_, err = ParseHBARules("host all all md5")
+	assert.ErrorIs(err, ErrInvalidHBA)
+	_, err = ParseHBARules("remote all all 0.0.0.0/0 md5")
+	assert.ErrorIs(err, ErrInvalidHBA)
+}
+
+func TestHBARuleValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil((&HBARule{Type: "host", Database: "all", User: "all", Address: "::1/128", Method: "trust"}).Validate())
+	assert.ErrorIs((&HBARule{Type: "host", Database: "all", User: "all", Method: "trust"}).Validate(), ErrInvalidHBA)
+	assert.ErrorIs((&HBARule{Type: "local", Database: "all", User: "all", Address: "::1/128", Method: "trust"}).Validate(), ErrInvalidHBA)
+	assert.ErrorIs((&HBARule{Type: "local", Database: "all", User: "all\nhost", Method: "trust"}).Validate(), ErrInvalidHBA)
+}
+
+func TestRenderHBA(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := []*HBARule{
+		{Type: "local", Database: "all", User: "all", Method: "peer"},
+		{Type: "host", Database: "all", User: "all", Address: "10.0.0.0/8", Method: "ldap", Options: `ldapserver=ldap.example.net ldapprefix="cn="`},
+	}
+	r := RenderHBA(rules)
+	assert.Equal(hbaHeader+
+		"local    all          all                                   peer\n"+
+		"host     all          all          10.0.0.0/8               ldap ldapserver=ldap.example.net ldapprefix=\"cn=\"\n", r)
+
+	parsed, err := ParseHBARules(r)
+	assert.Nil(err)
+	assert.Equal(rules, parsed)
+}
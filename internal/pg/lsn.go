@@ -0,0 +1,78 @@
+package pg
+
+import (
+	"fmt"
+	"time"
+)
+
+// LSN is a PostgreSQL Log Sequence Number, a byte position in the WAL stream.
+type LSN uint64
+
+// InvalidLSN is the zero LSN, reported when the position is unknown.
+const InvalidLSN LSN = 0
+
+// ParseLSN parses LSN in the PostgreSQL text format, e.g. 16/B374D848.
+func ParseLSN(s string) (LSN, error) {
+	var hi, lo uint32
+	if _, err := fmt.Sscanf(s, "%X/%X", &hi, &lo); err != nil {
+		return InvalidLSN, fmt.Errorf("invalid LSN %q: %w", s, err)
+	}
+	return LSN(uint64(hi)<<32 | uint64(lo)), nil
+}
+
+// String returns LSN in the PostgreSQL text format.
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(l>>32), uint32(l))
+}
+
+// Diff returns the number of bytes l is ahead of o, negative if behind, like
+// pg_wal_lsn_diff().
+func (l LSN) Diff(o LSN) int64 {
+	return int64(l - o)
+}
+
+// Distance returns the number of bytes l is ahead of o, 0 if it is not.
+func (l LSN) Distance(o LSN) uint64 {
+	if l <= o {
+		return 0
+	}
+	return uint64(l - o)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (l LSN) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (l *LSN) UnmarshalText(b []byte) (err error) {
+	*l, err = ParseLSN(string(b))
+	return
+}
+
+// WalPosition contains the WAL positions of an instance.
+type WalPosition struct {
+	// Current is the current WAL write position of a master.
+	Current LSN `json:"current"`
+	// Received is the last WAL position received and synced to disk.
+	Received LSN `json:"received"`
+	// Replayed is the last WAL position replayed during recovery.
+	Replayed LSN `json:"replayed"`
+	// ReplayTimestamp is the commit time of the last transaction replayed
+	// during recovery, nil if none.
+	ReplayTimestamp *time.Time `json:"replay_timestamp,omitempty"`
+}
+
+// Max returns the most advanced of the positions received and replayed by a
+// standby.
+func (p *WalPosition) Max() LSN {
+	if p.Received > p.Replayed {
+		return p.Received
+	}
+	return p.Replayed
+}
+
+// ReplayLag returns the number of bytes received but not replayed yet.
+func (p *WalPosition) ReplayLag() uint64 {
+	return p.Received.Distance(p.Replayed)
+}
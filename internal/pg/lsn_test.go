@@ -0,0 +1,42 @@
+package pg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLSN(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := ParseLSN("16/B374D848")
+	assert.Nil(err)
+	assert.Equal(LSN(0x16B374D848), l)
+	assert.Equal("16/B374D848", l.String())
+
+	l, err = ParseLSN("0/0")
+	assert.Nil(err)
+	assert.Equal(InvalidLSN, l)
+
+	_, err = ParseLSN("invalid")
+	assert.NotNil(err)
+}
+
+func TestLSNDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := ParseLSN("0/3000148")
+	assert.Nil(err)
+	b, err := ParseLSN("0/3000000")
+	assert.Nil(err)
+
+	assert.True(a > b)
+	assert.Equal(int64(0x148), a.Diff(b))
+	assert.Equal(int64(-0x148), b.Diff(a))
+	assert.Equal(uint64(0x148), a.Distance(b))
+	assert.Equal(uint64(0), b.Distance(a))
+
+	p := WalPosition{Received: a, Replayed: b}
+	assert.Equal(a, p.Max())
+	assert.Equal(uint64(0x148), p.ReplayLag())
+}
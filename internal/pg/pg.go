@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"regexp"
@@ -12,7 +13,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/vontikov/pgcluster/internal/app"
 	"github.com/vontikov/pgcluster/internal/env"
 	"github.com/vontikov/pgcluster/internal/logging"
 	"github.com/vontikov/pgcluster/internal/util"
@@ -26,6 +29,7 @@ const (
 	DefaultLoggerName        = "pg"
 	DefaultConnectionTimeout = 30 * time.Second
 	DefaultPromotionTimeout  = 30 * time.Second
+	DefaultStatementTimeout  = 10 * time.Second
 )
 
 var (
@@ -58,31 +62,116 @@ type ConnectionInfo struct {
 	Port int    `json:"port"`
 }
 
-// Cluster provides access to database.
+// Cluster provides access to database. The calls are canceled when the
+// context is done, the statements are also canceled after the statement
+// timeout.
 type Cluster interface {
 	// Version returns Cluster version.
-	Version() (major int, minor int, err error)
+	Version(ctx context.Context) (major int, minor int, err error)
+
+	// Capabilities returns the capabilities of Cluster version.
+	Capabilities(ctx context.Context) (*Capabilities, error)
 
 	// Alive returns Cluster liveness status.
-	Alive() (bool, error)
+	Alive(ctx context.Context) (bool, error)
 
 	// InRecovery returns Cluster recovery status.
-	InRecovery() (bool, error)
+	InRecovery(ctx context.Context) (bool, error)
 
 	// MasterInfo returns the master info Cluster is a replica of.
-	MasterInfo() (*ConnectionInfo, error)
+	MasterInfo(ctx context.Context) (*ConnectionInfo, error)
+
+	// WalPosition returns the WAL positions of Cluster. The current position
+	// is InvalidLSN if Cluster is a standby, the received and replayed
+	// positions are InvalidLSN and the replay timestamp is nil if it is not.
+	WalPosition(ctx context.Context) (*WalPosition, error)
+
+	// ReplicationStatus returns the standbys connected to Cluster.
+	ReplicationStatus(ctx context.Context) ([]*StandbyStatus, error)
+
+	// ReplicationSlots returns the physical replication slots of Cluster.
+	ReplicationSlots(ctx context.Context) ([]*ReplicationSlot, error)
+
+	// CreateReplicationSlot creates the physical replication slot.
+	CreateReplicationSlot(ctx context.Context, name string) error
+
+	// DropReplicationSlot drops the physical replication slot.
+	DropReplicationSlot(ctx context.Context, name string) error
+
+	// SetPrimarySlotName makes the running standby stream from its
+	// replication slot, if the slot name is set. It takes effect on reload
+	// since PostgreSQL 13, on restart otherwise.
+	SetPrimarySlotName(ctx context.Context) error
+
+	// ControlData returns the pg_control data of Cluster.
+	ControlData(ctx context.Context) (*ControlData, error)
+
+	// Timeline returns the current timeline of the master.
+	Timeline(ctx context.Context) (int, error)
+
+	// SetReadOnly makes the master read-only and terminates the client
+	// sessions, or makes it writable again. It does not fence the writes,
+	// a new session may set itself writable.
+	SetReadOnly(ctx context.Context, v bool) error
+
+	// AlterSystem sets and resets the parameters with ALTER SYSTEM, then
+	// reloads the configuration. A parameter failed to be set does not
+	// prevent the others from being set.
+	AlterSystem(ctx context.Context, set map[string]string, reset []string) error
+
+	// SystemSettings returns the parameters set with ALTER SYSTEM, i.e. in
+	// postgresql.auto.conf, including the ones written by the agent.
+	SystemSettings(ctx context.Context) (map[string]string, error)
+
+	// PendingRestart returns the parameters changed which need a restart to
+	// take effect.
+	PendingRestart(ctx context.Context) ([]string, error)
+
+	// SetHBA replaces pg_hba.conf with the rules and reloads the
+	// configuration. The previous file is restored if the rules have errors
+	// or Cluster is not accessible with them.
+	SetHBA(ctx context.Context, rules []*HBARule) error
 
 	// Stop stops Cluster.
-	Stop() error
+	Stop(ctx context.Context) error
 
 	// Start starts Cluster.
-	Start() error
+	Start(ctx context.Context) error
 
 	// Promote promotes standby to master.
-	Promote() error
+	Promote(ctx context.Context) error
+
+	// Backup backs up Cluster from the host:port. The data directory is moved
+	// aside as a snapshot.
+	Backup(ctx context.Context, host string, port int) error
+
+	// StartBackupJob starts reinitialising Cluster from the host:port in the
+	// background: Cluster is stopped, backed up and started again. Only one
+	// job may run at a time, and not on the master. The job calls ready, if
+	// not nil, before Cluster is stopped. The job is not canceled with the
+	// context.
+	StartBackupJob(ctx context.Context, host string, port int, ready func()) (*BackupJob, error)
+
+	// BackupJob returns the latest backup job or nil if there is none.
+	BackupJob(ctx context.Context) *BackupJob
+
+	// Snapshots returns the data directory snapshots, the latest first.
+	Snapshots(ctx context.Context) ([]*Snapshot, error)
+
+	// DeleteSnapshot deletes the snapshot.
+	DeleteSnapshot(ctx context.Context, name string) error
+
+	// Rewind synchronizes the stopped Cluster with the host:port and
+	// configures it to follow the host:port.
+	Rewind(ctx context.Context, host string, port int) error
 
-	// Backup backs up Cluster from the host:port.
-	Backup(host string, port int) error
+	// SetPrimary configures the stopped standby to follow the host:port.
+	SetPrimary(ctx context.Context, host string, port int) error
+
+	// Stopped returns the channel which is closed when the supervised
+	// postmaster is stopped after the context is done. It is closed already
+	// if the postmaster is not supervised.
+	Stopped() <-chan struct{}
 }
 
 // Option defines configuration option.
@@ -106,6 +195,17 @@ func WithUser(v string) Option { return func(c *cluster) { c.user = v } }
 // WithPassword sets the user password.
 func WithPassword(v string) Option { return func(c *cluster) { c.password = v } }
 
+// WithPromotionTimeout sets the timeout for the promotion to complete.
+func WithPromotionTimeout(v time.Duration) Option {
+	return func(c *cluster) { c.promotionTimeout = v }
+}
+
+// WithStatementTimeout sets the timeout for the statements run by the
+// agent. Zero means no timeout.
+func WithStatementTimeout(v time.Duration) Option {
+	return func(c *cluster) { c.statementTimeout = v }
+}
+
 // WithPasswordFile provides password file.
 func WithPasswordFile(v string) Option {
 	/* #nosec */
@@ -118,6 +218,14 @@ func WithPasswordFile(v string) Option {
 	return func(c *cluster) { c.password = sc.Text() }
 }
 
+// WithSupervisor makes the cluster run the postmaster as a child process and
+// restart it if it crashes, instead of using pg_ctl.
+func WithSupervisor(v string) Option {
+	r, err := strconv.ParseBool(v)
+	util.PanicOnError(err)
+	return func(c *cluster) { c.supervise = r }
+}
+
 // cluster gives access to the local PostgreSQL cluster.
 // Provides convenience functions.
 type cluster struct {
@@ -132,9 +240,24 @@ type cluster struct {
 	logger            logging.Logger
 	connectionTimeout time.Duration
 	promotionTimeout  time.Duration
-
-	mu   sync.Mutex // protects following fields
-	pool *pgxpool.Pool
+	statementTimeout  time.Duration
+	supervise         bool
+	sup               *supervisor
+	snapshotKeep      int
+	snapshotMaxAge    time.Duration
+	snapshotMinFree   uint64
+	slotName          string
+
+	mu            sync.Mutex // protects following fields
+	pool          *pgxpool.Pool
+	caps          *Capabilities
+	snapshotSizes map[string]int64
+
+	// the job is not behind mu, which is held while connecting to the
+	// server, and the server is down while the job runs
+	jmu       sync.Mutex // protects following fields
+	job       *BackupJob
+	backingUp bool
 }
 
 // New returns new Cluster.
@@ -144,12 +267,23 @@ func New(ctx context.Context, opts ...Option) Cluster {
 		logger:            logging.NewLogger(DefaultLoggerName),
 		connectionTimeout: DefaultConnectionTimeout,
 		promotionTimeout:  DefaultPromotionTimeout,
+		statementTimeout:  DefaultStatementTimeout,
+		snapshotSizes:     make(map[string]int64),
 	}
 
 	for _, o := range opts {
 		o(c)
 	}
 
+	if c.supervise {
+		binDir, err := env.Get(env.PgBinDir)
+		util.PanicOnError(err)
+		dataDir, err := env.Get(env.PgData)
+		util.PanicOnError(err)
+		c.sup = newSupervisor(c.logger, binDir, dataDir)
+		go c.sup.run(ctx)
+	}
+
 	go func() {
 		<-ctx.Done()
 		c.poolDrop()
@@ -159,26 +293,12 @@ func New(ctx context.Context, opts ...Option) Cluster {
 }
 
 // Version implements Cluster.Version().
-func (c *cluster) Version() (major int, minor int, err error) {
+func (c *cluster) Version(ctx context.Context) (major int, minor int, err error) {
 	const sql = "SELECT version();"
 	const pattern = `PostgreSQL (\d+)\.(\d+).*`
 
-	pool, err := c.poolGetOrConnect()
-	if err != nil {
-		c.logger.Error("connection error", "message", err)
-		c.poolDrop()
-		return
-	}
-
-	conn, err := pool.Acquire(context.Background())
-	if err != nil {
-		return
-	}
-	defer conn.Release()
-
 	var s string
-	err = conn.QueryRow(c.ctx, sql).Scan(&s)
-	if err != nil {
+	if err = c.queryRow(ctx, sql, &s); err != nil {
 		return
 	}
 
@@ -190,97 +310,155 @@ func (c *cluster) Version() (major int, minor int, err error) {
 		return
 	}
 	minor, err = strconv.Atoi(string(m[0][2]))
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.caps = CapabilitiesOf(major)
+	c.mu.Unlock()
 	return
 }
 
 // Alive implements Cluster.Alive().
-func (c *cluster) Alive() (r bool, err error) {
+func (c *cluster) Alive(ctx context.Context) (r bool, err error) {
 	const sql = "SELECT true"
 
-	pool, err := c.poolGetOrConnect()
-	if err != nil {
-		c.logger.Error("connection error", "message", err)
-		c.poolDrop()
-		return
-	}
-
-	conn, err := pool.Acquire(context.Background())
-	if err != nil {
-		return
-	}
-	defer conn.Release()
-
-	err = conn.QueryRow(c.ctx, sql).Scan(&r)
+	err = c.queryRow(ctx, sql, &r)
 	return
 }
 
 // InRecovery implements Cluster.InRecovery().
-func (c *cluster) InRecovery() (r bool, err error) {
+func (c *cluster) InRecovery(ctx context.Context) (r bool, err error) {
 	const sql = "SELECT pg_is_in_recovery()"
 
-	pool, err := c.poolGetOrConnect()
-	if err != nil {
-		c.logger.Error("connection error", "message", err)
-		c.poolDrop()
-		return
-	}
-
-	conn, err := pool.Acquire(context.Background())
-	if err != nil {
-		return
-	}
-	defer conn.Release()
-
-	err = conn.QueryRow(c.ctx, sql).Scan(&r)
+	err = c.queryRow(ctx, sql, &r)
 	return
 }
 
 // MasterInfo implements Cluster.MasterInfo().
-func (c *cluster) MasterInfo() (hi *ConnectionInfo, err error) {
+func (c *cluster) MasterInfo(ctx context.Context) (hi *ConnectionInfo, err error) {
 	const sql = "SELECT sender_host, sender_port from pg_stat_wal_receiver"
 
-	pool, err := c.poolGetOrConnect()
-	if err != nil {
-		c.logger.Error("connection error", "message", err)
-		c.poolDrop()
+	var host *string
+	var port *int32
+	err = c.queryRow(ctx, sql, &host, &port)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil || host == nil || port == nil {
 		return
 	}
+	hi = &ConnectionInfo{
+		Host: *host,
+		Port: int(*port),
+	}
+	return
+}
 
-	conn, err := pool.Acquire(context.Background())
+// WalPosition implements Cluster.WalPosition().
+func (c *cluster) WalPosition(ctx context.Context) (p *WalPosition, err error) {
+	const sql = `
+SELECT
+  CASE WHEN pg_is_in_recovery() THEN NULL ELSE pg_current_wal_lsn()::text END,
+  pg_last_wal_receive_lsn()::text,
+  pg_last_wal_replay_lsn()::text,
+  pg_last_xact_replay_timestamp()`
+
+	var current, received, replayed *string
+	var ts *time.Time
+	err = c.queryRow(ctx, sql, &current, &received, &replayed, &ts)
 	if err != nil {
 		return
 	}
-	defer conn.Release()
 
-	rows, err := conn.Query(c.ctx, sql)
-	if err != nil {
-		return
+	p = &WalPosition{ReplayTimestamp: ts}
+	if current != nil {
+		if p.Current, err = ParseLSN(*current); err != nil {
+			return nil, err
+		}
 	}
-	defer rows.Close()
+	if received != nil {
+		if p.Received, err = ParseLSN(*received); err != nil {
+			return nil, err
+		}
+	}
+	if replayed != nil {
+		if p.Replayed, err = ParseLSN(*replayed); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
 
-	if !rows.Next() {
+// Timeline implements Cluster.Timeline().
+func (c *cluster) Timeline(ctx context.Context) (tl int, err error) {
+	const sql = "SELECT pg_walfile_name(pg_current_wal_lsn())"
+
+	var s string
+	if err = c.queryRow(ctx, sql, &s); err != nil {
 		return
 	}
 
-	vals, err := rows.Values()
+	// the WAL file name starts with 8 hex digits of the timeline
+	r, err := strconv.ParseInt(s[:8], 16, 64)
 	if err != nil {
 		return
 	}
-	hi = &ConnectionInfo{
-		Host: vals[0].(string),
-		Port: int(vals[1].(int32)),
-	}
+	tl = int(r)
 	return
 }
 
+// SetReadOnly implements Cluster.SetReadOnly().
+func (c *cluster) SetReadOnly(ctx context.Context, v bool) (err error) {
+	const terminate = `
+SELECT pg_terminate_backend(pid) FROM pg_stat_activity
+WHERE backend_type = 'client backend'
+  AND pid <> pg_backend_pid()
+  AND application_name <> $1`
+
+	c.logger.Warn("setting read-only", "value", v)
+
+	alter := "ALTER SYSTEM RESET default_transaction_read_only"
+	if v {
+		alter = "ALTER SYSTEM SET default_transaction_read_only = on"
+	}
+	err = c.withConn(ctx, func(ctx context.Context, conn *pgxpool.Conn) (err error) {
+		if _, err = conn.Exec(ctx, alter); err != nil {
+			return
+		}
+		if _, err = conn.Exec(ctx, "SELECT pg_reload_conf()"); err != nil {
+			return
+		}
+		if !v {
+			return
+		}
+		// the sessions opened before the reload are still writable
+		_, err = conn.Exec(ctx, terminate, app.App)
+		return
+	})
+	if err != nil || !v {
+		return
+	}
+
+	// a checkpoint may take longer than a statement
+	return c.withConnTimeout(ctx, 0, func(ctx context.Context, conn *pgxpool.Conn) error {
+		_, err := conn.Exec(ctx, "CHECKPOINT")
+		return err
+	})
+}
+
 // Stop implements Cluster.Stop().
-func (c *cluster) Stop() (err error) {
+func (c *cluster) Stop(ctx context.Context) (err error) {
 	c.logger.Warn("stopping cluster")
+	if c.sup != nil {
+		return c.sup.stop()
+	}
 	dir, err := env.Get(env.PgBinDir)
 	if err != nil {
 		return
 	}
-	cmd := exec.Command(fmt.Sprintf("%s/pg_ctl", dir), "stop")
+	cmd := exec.CommandContext(ctx, fmt.Sprintf("%s/pg_ctl", dir), "stop", "-m", "fast")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	err = cmd.Run()
@@ -290,14 +468,27 @@ func (c *cluster) Stop() (err error) {
 	return
 }
 
+// Stopped implements Cluster.Stopped().
+func (c *cluster) Stopped() <-chan struct{} {
+	if c.sup != nil {
+		return c.sup.done
+	}
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
 // Start implements Cluster.Start().
-func (c *cluster) Start() (err error) {
+func (c *cluster) Start(ctx context.Context) (err error) {
 	c.logger.Warn("starting cluster")
+	if c.sup != nil {
+		return c.sup.start()
+	}
 	dir, err := env.Get(env.PgBinDir)
 	if err != nil {
 		return
 	}
-	cmd := exec.Command(fmt.Sprintf("%s/pg_ctl", dir), "start")
+	cmd := exec.CommandContext(ctx, fmt.Sprintf("%s/pg_ctl", dir), "start")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	err = cmd.Run()
@@ -308,8 +499,8 @@ func (c *cluster) Start() (err error) {
 }
 
 // Promote implements Cluster.Promote().
-func (c *cluster) Promote() (err error) {
-	r, err := c.InRecovery()
+func (c *cluster) Promote(ctx context.Context) (err error) {
+	r, err := c.InRecovery(ctx)
 	if err != nil {
 		return
 	}
@@ -317,6 +508,39 @@ func (c *cluster) Promote() (err error) {
 		return ErrNotInRecovery
 	}
 
+	caps, err := c.Capabilities(ctx)
+	if err != nil {
+		return
+	}
+	if caps.PgPromote {
+		return c.pgPromote(ctx)
+	}
+	return c.promoteTrigger(ctx)
+}
+
+// pgPromote promotes the standby with pg_promote() and waits for the
+// promotion to complete.
+func (c *cluster) pgPromote(ctx context.Context) (err error) {
+	const sql = "SELECT pg_promote(true, $1)"
+
+	c.logger.Debug("promoting", "timeout", c.promotionTimeout)
+	var r bool
+	// pg_promote() waits for the promotion up to the promotion timeout
+	err = c.withConnTimeout(ctx, c.promotionTimeout+c.statementTimeout, func(ctx context.Context, conn *pgxpool.Conn) error {
+		return conn.QueryRow(ctx, sql, int(c.promotionTimeout.Seconds())).Scan(&r)
+	})
+	if err != nil {
+		return
+	}
+	if !r {
+		return ErrPromotionTimeout
+	}
+	return
+}
+
+// promoteTrigger promotes the standby of the versions prior to 12 with the
+// trigger file and waits for the promotion to complete.
+func (c *cluster) promoteTrigger(ctx context.Context) (err error) {
 	c.logger.Debug("creating trigger", "name", ReplicationPromoteTriggerFile)
 	f, err := os.Create(ReplicationPromoteTriggerFile)
 	if err != nil {
@@ -327,7 +551,7 @@ func (c *cluster) Promote() (err error) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(c.ctx, DefaultPromotionTimeout)
+	ctx, cancel := context.WithTimeout(ctx, c.promotionTimeout)
 	defer cancel()
 
 	for {
@@ -335,12 +559,12 @@ func (c *cluster) Promote() (err error) {
 		case <-ctx.Done():
 			return ErrPromotionTimeout
 		default:
-			r, err = c.InRecovery()
+			r, err := c.InRecovery(ctx)
 			if err != nil {
-				return
+				return err
 			}
 			if !r {
-				return
+				return nil
 			}
 			time.Sleep(1 * time.Second)
 		}
@@ -348,7 +572,13 @@ func (c *cluster) Promote() (err error) {
 }
 
 //  Backup implements Cluster.Backup().
-func (c *cluster) Backup(host string, port int) (err error) {
+func (c *cluster) Backup(ctx context.Context, host string, port int) error {
+	return c.backup(ctx, host, port, nil)
+}
+
+// backup backs up Cluster from the host:port reporting the progress of
+// pg_basebackup to the progress function if not nil.
+func (c *cluster) backup(ctx context.Context, host string, port int, progress func(done, total int64)) (err error) {
 	c.logger.Warn("backup from", "host", host, "port", port)
 
 	user, err := env.Get(env.PgReplicationUser)
@@ -367,11 +597,36 @@ func (c *cluster) Backup(host string, port int) (err error) {
 	if err != nil {
 		return
 	}
-	backupDir := fmt.Sprintf("%s/%s", backupRoot, time.Now().Format("20060102150405"))
+	backupDir := fmt.Sprintf("%s/%s", backupRoot, time.Now().Format(snapshotLayout))
 	c.logger.Debug("backup directory", "path", backupDir)
 
-	err = os.Rename(dataDir, backupDir)
+	// read before the data directory is moved
+	caps, err := c.Capabilities(ctx)
 	if err != nil {
+		return
+	}
+
+	c.jmu.Lock()
+	c.backingUp = true
+	c.jmu.Unlock()
+	defer func() {
+		c.jmu.Lock()
+		c.backingUp = false
+		c.jmu.Unlock()
+	}()
+
+	// the backup may need the space, it is not freed otherwise if it fails
+	if snapshots, serr := c.Snapshots(ctx); serr != nil {
+		c.logger.Error("snapshot retention error", "message", serr)
+	} else if serr := c.freeSnapshots(ctx, snapshots); serr != nil {
+		c.logger.Error("snapshot retention error", "message", serr)
+	}
+
+	// a failed backup leaves no data directory, there is nothing to move aside
+	// when it is retried
+	if _, err = os.Stat(dataDir); os.IsNotExist(err) {
+		c.logger.Warn("data directory is missing", "path", dataDir)
+	} else if err = os.Rename(dataDir, backupDir); err != nil {
 		c.logger.Error("backup error", "message", err)
 		return
 	}
@@ -386,14 +641,85 @@ func (c *cluster) Backup(host string, port int) (err error) {
 		"-v",
 	}
 
-	cmd := exec.Command("pg_basebackup", args...)
+	cmd := exec.CommandContext(ctx, "pg_basebackup", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if progress != nil {
+		cmd.Stderr = io.MultiWriter(os.Stderr, &progressWriter{f: progress})
+	}
+	if err = cmd.Run(); err != nil {
+		return
+	}
+	// the snapshot is the only copy of the data until the backup succeeds
+	if err := c.pruneSnapshots(ctx); err != nil {
+		c.logger.Error("snapshot retention error", "message", err)
+	}
+	if !caps.StandbySignal {
+		// recovery.conf written by -R lacks the promotion trigger file
+		return c.writeStandbyConfig(caps, host, port)
+	}
+	return c.writePrimarySlotName(caps)
+}
+
+// Rewind implements Cluster.Rewind().
+func (c *cluster) Rewind(ctx context.Context, host string, port int) (err error) {
+	c.logger.Warn("rewind from", "host", host, "port", port)
+
+	user, err := env.Get(env.PgReplicationUser)
+	if err != nil {
+		return
+	}
+
+	dataDir, err := env.Get(env.PgData)
+	if err != nil {
+		return
+	}
+
+	dir, err := env.Get(env.PgBinDir)
+	if err != nil {
+		return
+	}
+
+	caps, err := c.Capabilities(ctx)
+	if err != nil {
+		return
+	}
+
+	args := []string{
+		"--target-pgdata", dataDir,
+		"--source-server", fmt.Sprintf("host=%s port=%d user=%s dbname=%s", host, port, user, c.db),
+		"--progress",
+	}
+	if caps.RewindWriteRecoveryConf {
+		args = append(args, "--write-recovery-conf")
+	}
+
+	cmd := exec.CommandContext(ctx, fmt.Sprintf("%s/pg_rewind", dir), args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	err = cmd.Run()
-	return
+	if err != nil {
+		c.logger.Error("rewind error", "message", err)
+		return
+	}
+	if !caps.RewindWriteRecoveryConf {
+		return c.writeStandbyConfig(caps, host, port)
+	}
+	return c.writePrimarySlotName(caps)
 }
 
-func (c *cluster) poolGetOrConnect() (pool *pgxpool.Pool, err error) {
+// SetPrimary implements Cluster.SetPrimary().
+func (c *cluster) SetPrimary(ctx context.Context, host string, port int) (err error) {
+	c.logger.Info("setting primary", "host", host, "port", port)
+
+	caps, err := c.Capabilities(ctx)
+	if err != nil {
+		return
+	}
+	return c.writeStandbyConfig(caps, host, port)
+}
+
+func (c *cluster) poolGetOrConnect(ctx context.Context) (pool *pgxpool.Pool, err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -405,10 +731,7 @@ func (c *cluster) poolGetOrConnect() (pool *pgxpool.Pool, err error) {
 	}
 
 	c.logger.Debug("opening connection...")
-	ctx, cancel := context.WithTimeout(context.Background(), c.connectionTimeout)
-	defer cancel()
-
-	connStr := fmt.Sprintf("postgresql://%s:%s@%s:%d/%s", c.user, c.password, c.host, c.port, c.db)
+	connStr := c.connString()
 	if pool, err = pgxpool.Connect(ctx, connStr); err == nil {
 		c.pool = pool
 		c.logger.Debug("connection established")
@@ -432,6 +755,60 @@ func (c *cluster) poolGetOrConnect() (pool *pgxpool.Pool, err error) {
 	}
 }
 
+// withConn runs the function with a pooled connection and the context
+// canceled after the statement timeout.
+func (c *cluster) withConn(ctx context.Context, f func(context.Context, *pgxpool.Conn) error) error {
+	return c.withConnTimeout(ctx, c.statementTimeout, f)
+}
+
+// withConnTimeout runs the function with a pooled connection and the context
+// canceled after the timeout, zero means no timeout. Connecting and acquiring
+// the connection is limited by the connection timeout.
+func (c *cluster) withConnTimeout(ctx context.Context, timeout time.Duration, f func(context.Context, *pgxpool.Conn) error) error {
+	cctx, cancel := context.WithTimeout(ctx, c.connectionTimeout)
+	defer cancel()
+
+	pool, err := c.poolGetOrConnect(cctx)
+	if err != nil {
+		c.logger.Error("connection error", "message", err)
+		c.poolDrop()
+		return err
+	}
+
+	conn, err := pool.Acquire(cctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return f(ctx, conn)
+}
+
+// queryRow runs the query and scans the row into dest.
+func (c *cluster) queryRow(ctx context.Context, sql string, dest ...interface{}) error {
+	return c.withConn(ctx, func(ctx context.Context, conn *pgxpool.Conn) error {
+		return conn.QueryRow(ctx, sql).Scan(dest...)
+	})
+}
+
+// execSQL runs the statement.
+func (c *cluster) execSQL(ctx context.Context, sql string, args ...interface{}) error {
+	return c.withConn(ctx, func(ctx context.Context, conn *pgxpool.Conn) error {
+		_, err := conn.Exec(ctx, sql, args...)
+		return err
+	})
+}
+
+func (c *cluster) connString() string {
+	return fmt.Sprintf("postgresql://%s:%s@%s:%d/%s?application_name=%s",
+		c.user, c.password, c.host, c.port, c.db, app.App)
+}
+
 func (c *cluster) poolDrop() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -2,6 +2,7 @@ package pg
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -20,7 +21,7 @@ func TestVersion(t *testing.T) {
 		WithUser(DefaultUser),
 	)
 	for i := 0; i < 10; i++ {
-		major, minor, err := cluster.Version()
+		major, minor, err := cluster.Version(ctx)
 		assert.Nil(err)
 		assert.Equal(imageMajorVersion, major)
 		assert.Equal(imageMinorVersion, minor)
@@ -39,7 +40,7 @@ func TestAlive(t *testing.T) {
 		WithDatabase(DefaultDatabase),
 		WithUser(DefaultUser),
 	)
-	assert.True(cluster.Alive())
+	assert.True(cluster.Alive(ctx))
 }
 
 func TestInRecovery(t *testing.T) {
@@ -54,7 +55,105 @@ func TestInRecovery(t *testing.T) {
 		WithDatabase(DefaultDatabase),
 		WithUser(DefaultUser),
 	)
-	r, err := cluster.InRecovery()
+	r, err := cluster.InRecovery(ctx)
 	assert.Nil(err)
 	assert.False(r)
 }
+
+func TestReplicationStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cluster := New(ctx,
+		WithHost(DefaultHost),
+		WithPort(DefaultPort),
+		WithDatabase(DefaultDatabase),
+		WithUser(DefaultUser),
+	)
+	r, err := cluster.ReplicationStatus(ctx)
+	assert.Nil(err)
+	assert.Empty(r)
+}
+
+func TestReplicationSlots(t *testing.T) {
+	const slot = "test_slot"
+
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cluster := New(ctx,
+		WithHost(DefaultHost),
+		WithPort(DefaultPort),
+		WithDatabase(DefaultDatabase),
+		WithUser(DefaultUser),
+	)
+	assert.Nil(cluster.CreateReplicationSlot(ctx, slot))
+	r, err := cluster.ReplicationSlots(ctx)
+	assert.Nil(err)
+	assert.Len(r, 1)
+	assert.Equal(slot, r[0].Name)
+	assert.False(r[0].Active)
+	assert.NotEqual(InvalidLSN, r[0].RestartLSN)
+
+	assert.Nil(cluster.DropReplicationSlot(ctx, slot))
+	r, err = cluster.ReplicationSlots(ctx)
+	assert.Nil(err)
+	assert.Empty(r)
+}
+
+func TestAlterSystem(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cluster := New(ctx,
+		WithHost(DefaultHost),
+		WithPort(DefaultPort),
+		WithDatabase(DefaultDatabase),
+		WithUser(DefaultUser),
+	)
+	assert.Nil(cluster.AlterSystem(ctx, map[string]string{"work_mem": "8MB"}, nil))
+	settings, err := cluster.SystemSettings(ctx)
+	assert.Nil(err)
+	assert.Equal("8MB", settings["work_mem"])
+
+	err = cluster.AlterSystem(ctx, map[string]string{"no_such_parameter": "1"}, nil)
+	var perr *ParameterError
+	assert.True(errors.As(err, &perr))
+	assert.Contains(perr.Errors, "no_such_parameter")
+
+	assert.Nil(cluster.AlterSystem(ctx, nil, []string{"work_mem"}))
+	settings, err = cluster.SystemSettings(ctx)
+	assert.Nil(err)
+	assert.NotContains(settings, "work_mem")
+
+	r, err := cluster.PendingRestart(ctx)
+	assert.Nil(err)
+	assert.Empty(r)
+}
+
+func TestSetHBAInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cluster := New(ctx,
+		WithHost(DefaultHost),
+		WithPort(DefaultPort),
+		WithDatabase(DefaultDatabase),
+		WithUser(DefaultUser),
+	)
+	err := cluster.SetHBA(ctx, []*HBARule{{Type: "host", Database: "all", User: "all", Address: "0.0.0.0/0", Method: "no_such_method"}})
+	assert.ErrorIs(err, ErrInvalidHBA)
+
+	// restored
+	alive, err := cluster.Alive(ctx)
+	assert.Nil(err)
+	assert.True(alive)
+}
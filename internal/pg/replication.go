@@ -0,0 +1,108 @@
+package pg
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// StandbyStatus describes a standby connected to the master as reported by
+// pg_stat_replication. The lags are in seconds.
+type StandbyStatus struct {
+	ApplicationName string  `json:"application_name"`
+	ClientAddr      string  `json:"client_addr"`
+	State           string  `json:"state"`
+	SentLSN         LSN     `json:"sent_lsn"`
+	WriteLSN        LSN     `json:"write_lsn"`
+	FlushLSN        LSN     `json:"flush_lsn"`
+	ReplayLSN       LSN     `json:"replay_lsn"`
+	WriteLag        float64 `json:"write_lag"`
+	FlushLag        float64 `json:"flush_lag"`
+	ReplayLag       float64 `json:"replay_lag"`
+	ReplayLagBytes  uint64  `json:"replay_lag_bytes"`
+	SyncState       string  `json:"sync_state"`
+}
+
+// ReplicationStatus implements Cluster.ReplicationStatus().
+func (c *cluster) ReplicationStatus(ctx context.Context) (r []*StandbyStatus, err error) {
+	const sql = `
+SELECT
+  application_name,
+  client_addr::text,
+  state,
+  sent_lsn::text,
+  write_lsn::text,
+  flush_lsn::text,
+  replay_lsn::text,
+  EXTRACT(EPOCH FROM write_lag)::float8,
+  EXTRACT(EPOCH FROM flush_lag)::float8,
+  EXTRACT(EPOCH FROM replay_lag)::float8,
+  CASE WHEN pg_is_in_recovery() THEN NULL
+    ELSE pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn)::float8 END,
+  sync_state
+FROM pg_stat_replication
+ORDER BY application_name`
+
+	err = c.withConn(ctx, func(ctx context.Context, conn *pgxpool.Conn) error {
+		rows, err := conn.Query(ctx, sql)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		r = []*StandbyStatus{}
+		for rows.Next() {
+			var (
+				name, addr, state, syncState      *string
+				sent, write, flush, replay        *string
+				writeLag, flushLag, replayLag, lb *float64
+			)
+			if err := rows.Scan(&name, &addr, &state, &sent, &write, &flush, &replay,
+				&writeLag, &flushLag, &replayLag, &lb, &syncState); err != nil {
+				return err
+			}
+
+			s := &StandbyStatus{
+				ApplicationName: stringOrEmpty(name),
+				ClientAddr:      stringOrEmpty(addr),
+				State:           stringOrEmpty(state),
+				WriteLag:        floatOrZero(writeLag),
+				FlushLag:        floatOrZero(flushLag),
+				ReplayLag:       floatOrZero(replayLag),
+				ReplayLagBytes:  uint64(floatOrZero(lb)),
+				SyncState:       stringOrEmpty(syncState),
+			}
+			for _, v := range []struct {
+				dst *LSN
+				src *string
+			}{{&s.SentLSN, sent}, {&s.WriteLSN, write}, {&s.FlushLSN, flush}, {&s.ReplayLSN, replay}} {
+				if v.src == nil {
+					continue
+				}
+				if *v.dst, err = ParseLSN(*v.src); err != nil {
+					return err
+				}
+			}
+			r = append(r, s)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func stringOrEmpty(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+func floatOrZero(v *float64) float64 {
+	if v == nil || *v < 0 {
+		return 0
+	}
+	return *v
+}
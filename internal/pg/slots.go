@@ -0,0 +1,181 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/vontikov/pgcluster/internal/env"
+)
+
+const (
+	// SlotPrefix is the name prefix of the replication slots managed by the
+	// agent.
+	SlotPrefix = "pgcluster_"
+
+	// maxSlotNameLen is the maximum length of a replication slot name.
+	maxSlotNameLen = 63
+)
+
+// ReplicationSlot describes a physical replication slot.
+type ReplicationSlot struct {
+	Name       string `json:"name"`
+	Active     bool   `json:"active"`
+	RestartLSN LSN    `json:"restart_lsn"`
+}
+
+// WithSlotName sets the name of the replication slot Cluster streams from when
+// it is a standby. Slots are not used if it is empty.
+func WithSlotName(v string) Option { return func(c *cluster) { c.slotName = SlotName(v) } }
+
+// SlotName returns the replication slot name of the member: the slot prefix
+// followed by lower case letters, digits and underscores only. If the name is
+// changed to fit, a hash of the member name is appended for the different
+// members not to share the slot.
+func SlotName(member string) string {
+	name := SlotPrefix + member
+	r := []rune(strings.ToLower(name))
+	for i, c := range r {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' {
+			r[i] = '_'
+		}
+	}
+	if string(r) == name && len(r) <= maxSlotNameLen {
+		return name
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(member))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+	if n := maxSlotNameLen - len(suffix); len(r) > n {
+		r = r[:n]
+	}
+	return string(r) + suffix
+}
+
+// ManagedSlot reports whether the replication slot is managed by the agent.
+func ManagedSlot(name string) bool {
+	return strings.HasPrefix(name, SlotPrefix)
+}
+
+// ReplicationSlots implements Cluster.ReplicationSlots().
+func (c *cluster) ReplicationSlots(ctx context.Context) (r []*ReplicationSlot, err error) {
+	const sql = `
+SELECT slot_name, active, restart_lsn::text
+FROM pg_replication_slots
+WHERE slot_type = 'physical'
+ORDER BY slot_name`
+
+	err = c.withConn(ctx, func(ctx context.Context, conn *pgxpool.Conn) error {
+		rows, err := conn.Query(ctx, sql)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		r = []*ReplicationSlot{}
+		for rows.Next() {
+			var s ReplicationSlot
+			var lsn *string
+			if err := rows.Scan(&s.Name, &s.Active, &lsn); err != nil {
+				return err
+			}
+			if lsn != nil {
+				if s.RestartLSN, err = ParseLSN(*lsn); err != nil {
+					return err
+				}
+			}
+			r = append(r, &s)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// CreateReplicationSlot implements Cluster.CreateReplicationSlot().
+func (c *cluster) CreateReplicationSlot(ctx context.Context, name string) error {
+	// reserve WAL immediately, the standby may be behind
+	const sql = "SELECT pg_create_physical_replication_slot($1, true)"
+
+	c.logger.Info("creating replication slot", "name", name)
+	return c.execSQL(ctx, sql, name)
+}
+
+// DropReplicationSlot implements Cluster.DropReplicationSlot().
+func (c *cluster) DropReplicationSlot(ctx context.Context, name string) error {
+	const sql = "SELECT pg_drop_replication_slot($1)"
+
+	c.logger.Warn("dropping replication slot", "name", name)
+	return c.execSQL(ctx, sql, name)
+}
+
+// SetPrimarySlotName implements Cluster.SetPrimarySlotName().
+func (c *cluster) SetPrimarySlotName(ctx context.Context) error {
+	if c.slotName == "" {
+		return nil
+	}
+	caps, err := c.Capabilities(ctx)
+	if err != nil {
+		return err
+	}
+	if !caps.PrimarySlotName {
+		// recovery.conf is not written by ALTER SYSTEM
+		return c.writePrimarySlotName(caps)
+	}
+	return c.withConn(ctx, func(ctx context.Context, conn *pgxpool.Conn) error {
+		var current string
+		if err := conn.QueryRow(ctx, "SHOW primary_slot_name").Scan(&current); err != nil {
+			return err
+		}
+		if current == c.slotName {
+			return nil
+		}
+		c.logger.Info("setting primary slot name", "name", c.slotName)
+		if _, err := conn.Exec(ctx, "ALTER SYSTEM SET primary_slot_name = "+quoteLiteral(c.slotName)); err != nil {
+			return err
+		}
+		_, err := conn.Exec(ctx, "SELECT pg_reload_conf()")
+		return err
+	})
+}
+
+// writePrimarySlotName sets primary_slot_name of the stopped standby if the
+// slot name is set.
+func (c *cluster) writePrimarySlotName(caps *Capabilities) error {
+	if c.slotName == "" {
+		return nil
+	}
+	dataDir, err := env.Get(env.PgData)
+	if err != nil {
+		return err
+	}
+	file := "postgresql.auto.conf"
+	if !caps.PrimarySlotName {
+		file = "recovery.conf"
+	}
+	return setParameter(filepath.Join(dataDir, file), "primary_slot_name",
+		fmt.Sprintf("primary_slot_name = '%s'", c.slotName))
+}
+
+// setParameter replaces the parameter in the configuration file with the line.
+func setParameter(path, name, line string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var lines []string
+	for _, l := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		if l != "" && !strings.HasPrefix(strings.TrimSpace(l), name) {
+			lines = append(lines, l)
+		}
+	}
+	lines = append(lines, line, "")
+	return ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600)
+}
@@ -0,0 +1,44 @@
+package pg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlotName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("pgcluster_pg_replica_1", SlotName("pg_replica_1"))
+	assert.Regexp("^pgcluster_pg_replica_1_[0-9a-f]{8}$", SlotName("pg-replica.1"))
+	assert.Regexp("^pgcluster_abc123_[0-9a-f]{8}$", SlotName("ABC123"))
+	assert.Len(SlotName(strings.Repeat("a", 100)), maxSlotNameLen)
+
+	// the members do not share a slot if their names are changed to fit
+	assert.NotEqual(SlotName("pg_replica_1"), SlotName("pg-replica.1"))
+	assert.NotEqual(SlotName("pg-replica.1"), SlotName("pg.replica-1"))
+	assert.NotEqual(SlotName(strings.Repeat("a", 100)+"1"), SlotName(strings.Repeat("a", 100)+"2"))
+	assert.True(ManagedSlot(SlotName("replica")))
+	assert.False(ManagedSlot("replica"))
+}
+
+func TestSetParameter(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "conf")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "postgresql.auto.conf")
+
+	conf := "# Do not edit this file manually!\nprimary_conninfo = 'host=a'\nprimary_slot_name = 'old'\n"
+	assert.Nil(ioutil.WriteFile(path, []byte(conf), 0600))
+
+	assert.Nil(setParameter(path, "primary_slot_name", "primary_slot_name = 'new'"))
+	b, err := ioutil.ReadFile(path)
+	assert.Nil(err)
+	assert.Equal("# Do not edit this file manually!\nprimary_conninfo = 'host=a'\nprimary_slot_name = 'new'\n", string(b))
+}
@@ -0,0 +1,231 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/env"
+	"github.com/vontikov/pgcluster/internal/util"
+)
+
+// snapshotLayout is the layout of the snapshot names.
+const snapshotLayout = "20060102150405"
+
+// ErrSnapshotNotFound is returned when the snapshot does not exist.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot describes a data directory moved aside by Backup.
+type Snapshot struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+}
+
+// WithSnapshotKeep sets the number of the latest snapshots to keep. Zero keeps
+// all unless the max age is set.
+func WithSnapshotKeep(v string) Option {
+	n, err := strconv.Atoi(v)
+	util.PanicOnError(err)
+	return func(c *cluster) { c.snapshotKeep = n }
+}
+
+// WithSnapshotMaxAge sets the age of the snapshots to keep regardless of their
+// number. Zero keeps all unless the number is set.
+func WithSnapshotMaxAge(v string) Option {
+	d, err := time.ParseDuration(v)
+	util.PanicOnError(err)
+	return func(c *cluster) { c.snapshotMaxAge = d }
+}
+
+// WithSnapshotMinFree sets the disk space in bytes to keep free by deleting
+// the oldest snapshots regardless of the retention.
+func WithSnapshotMinFree(v string) Option {
+	n, err := strconv.ParseUint(v, 10, 64)
+	util.PanicOnError(err)
+	return func(c *cluster) { c.snapshotMinFree = n }
+}
+
+// Snapshots implements Cluster.Snapshots().
+func (c *cluster) Snapshots(context.Context) ([]*Snapshot, error) {
+	root, err := env.Get(env.PgBackup)
+	if err != nil {
+		return nil, err
+	}
+	fis, err := ioutil.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Snapshot{}, nil
+		}
+		return nil, err
+	}
+
+	r := make([]*Snapshot, 0, len(fis))
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		t, err := time.ParseInLocation(snapshotLayout, fi.Name(), time.Local)
+		if err != nil {
+			t = fi.ModTime()
+		}
+		size, err := c.snapshotSize(filepath.Join(root, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, &Snapshot{Name: fi.Name(), CreatedAt: t, Size: size})
+	}
+	// the latest first
+	sort.Slice(r, func(i, j int) bool { return r[i].CreatedAt.After(r[j].CreatedAt) })
+	return r, nil
+}
+
+// snapshotSize returns the size of the snapshot. Snapshots do not change, so
+// the sizes are cached.
+func (c *cluster) snapshotSize(path string) (int64, error) {
+	c.mu.Lock()
+	size, ok := c.snapshotSizes[path]
+	c.mu.Unlock()
+	if ok {
+		return size, nil
+	}
+
+	err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.snapshotSizes[path] = size
+	c.mu.Unlock()
+	return size, nil
+}
+
+// DeleteSnapshot implements Cluster.DeleteSnapshot().
+func (c *cluster) DeleteSnapshot(ctx context.Context, name string) error {
+	// the data directory may have just been moved into the snapshot
+	c.jmu.Lock()
+	busy := c.backingUp || (c.job != nil && c.job.Status == BackupJobRunning)
+	c.jmu.Unlock()
+	if busy {
+		return ErrBackupInProgress
+	}
+	return c.deleteSnapshot(ctx, name)
+}
+
+func (c *cluster) deleteSnapshot(_ context.Context, name string) error {
+	root, err := env.Get(env.PgBackup)
+	if err != nil {
+		return err
+	}
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return fmt.Errorf("%w: %q", ErrSnapshotNotFound, name)
+	}
+	path := filepath.Join(root, name)
+	if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+		return fmt.Errorf("%w: %q", ErrSnapshotNotFound, name)
+	}
+
+	c.logger.Warn("deleting snapshot", "name", name)
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	delete(c.snapshotSizes, path)
+	c.mu.Unlock()
+	return nil
+}
+
+// pruneSnapshots deletes the snapshots not retained, then the oldest ones
+// while the free disk space is less than the minimum. The latest snapshot is
+// never deleted.
+func (c *cluster) pruneSnapshots(ctx context.Context) error {
+	snapshots, err := c.Snapshots(ctx)
+	if err != nil {
+		return err
+	}
+
+	var kept []*Snapshot
+	for i, s := range snapshots {
+		if i == 0 || retained(i, s, c.snapshotKeep, c.snapshotMaxAge) {
+			kept = append(kept, s)
+			continue
+		}
+		if err := c.deleteSnapshot(ctx, s.Name); err != nil {
+			return err
+		}
+	}
+	return c.freeSnapshots(ctx, kept)
+}
+
+// freeSnapshots deletes the oldest of the snapshots, the latest first, while
+// the free disk space is less than the minimum. The latest snapshot is never
+// deleted.
+func (c *cluster) freeSnapshots(ctx context.Context, snapshots []*Snapshot) error {
+	if c.snapshotMinFree == 0 {
+		return nil
+	}
+	root, err := env.Get(env.PgBackup)
+	if err != nil {
+		return err
+	}
+	for i := len(snapshots) - 1; i > 0; i-- {
+		free, err := freeSpace(root)
+		if err != nil {
+			return err
+		}
+		if free >= c.snapshotMinFree {
+			return nil
+		}
+		c.logger.Warn("low disk space", "free", free, "min", c.snapshotMinFree)
+		if err := c.deleteSnapshot(ctx, snapshots[i].Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retained reports whether the i-th latest snapshot is retained: it is one of
+// the latest keep snapshots or it is newer than maxAge. Everything is retained
+// if neither is set.
+func retained(i int, s *Snapshot, keep int, maxAge time.Duration) bool {
+	if keep <= 0 && maxAge <= 0 {
+		return true
+	}
+	if keep > 0 && i < keep {
+		return true
+	}
+	return maxAge > 0 && time.Since(s.CreatedAt) < maxAge
+}
+
+// SnapshotsSize returns the disk space used by the snapshots in bytes.
+func SnapshotsSize(snapshots []*Snapshot) int64 {
+	var r int64
+	for _, s := range snapshots {
+		r += s.Size
+	}
+	return r
+}
+
+func freeSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
@@ -0,0 +1,112 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vontikov/pgcluster/internal/env"
+)
+
+func TestPruneSnapshots(t *testing.T) {
+	assert := assert.New(t)
+
+	root, err := ioutil.TempDir("", "backup")
+	assert.Nil(err)
+	defer os.RemoveAll(root)
+
+	defer os.Setenv(env.PgBackup, os.Getenv(env.PgBackup))
+	os.Setenv(env.PgBackup, root)
+
+	now := time.Now()
+	var names []string
+	for _, age := range []time.Duration{time.Minute, time.Hour, 2 * time.Hour, 48 * time.Hour} {
+		name := now.Add(-age).Format(snapshotLayout)
+		names = append(names, name)
+		assert.Nil(os.Mkdir(filepath.Join(root, name), 0700))
+		assert.Nil(ioutil.WriteFile(filepath.Join(root, name, "PG_VERSION"), []byte("13\n"), 0600))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := New(ctx, WithSnapshotKeep("1"), WithSnapshotMaxAge("90m")).(*cluster)
+
+	r, err := c.Snapshots(ctx)
+	assert.Nil(err)
+	assert.Len(r, 4)
+	assert.Equal(names[0], r[0].Name)
+	assert.Equal(int64(12), SnapshotsSize(r))
+
+	// the latest one and the one newer than the max age are retained
+	assert.Nil(c.pruneSnapshots(ctx))
+	r, err = c.Snapshots(ctx)
+	assert.Nil(err)
+	assert.Len(r, 2)
+	assert.Equal(names[0], r[0].Name)
+	assert.Equal(names[1], r[1].Name)
+
+	assert.Nil(c.DeleteSnapshot(ctx, names[1]))
+	assert.True(errors.Is(c.DeleteSnapshot(ctx, names[1]), ErrSnapshotNotFound))
+	assert.True(errors.Is(c.DeleteSnapshot(ctx, "../"+filepath.Base(root)), ErrSnapshotNotFound))
+
+	r, err = c.Snapshots(ctx)
+	assert.Nil(err)
+	assert.Len(r, 1)
+
+	// the latest one is retained whatever the free disk space
+	assert.Nil(os.Mkdir(filepath.Join(root, names[2]), 0700))
+	c.snapshotMaxAge = 0
+	c.snapshotMinFree = math.MaxUint64
+	assert.Nil(c.pruneSnapshots(ctx))
+	r, err = c.Snapshots(ctx)
+	assert.Nil(err)
+	assert.Len(r, 1)
+	assert.Equal(names[0], r[0].Name)
+}
+
+func TestRetained(t *testing.T) {
+	assert := assert.New(t)
+
+	old := &Snapshot{CreatedAt: time.Now().Add(-time.Hour)}
+	assert.True(retained(5, old, 0, 0))
+	assert.True(retained(0, old, 1, 0))
+	assert.False(retained(1, old, 1, 0))
+	assert.False(retained(1, old, 1, time.Minute))
+	assert.True(retained(1, old, 1, 2*time.Hour))
+	assert.True(retained(1, old, 0, 2*time.Hour))
+}
+
+func TestDeleteSnapshotBackupInProgress(t *testing.T) {
+	assert := assert.New(t)
+
+	root, err := ioutil.TempDir("", "backup")
+	assert.Nil(err)
+	defer os.RemoveAll(root)
+
+	defer os.Setenv(env.PgBackup, os.Getenv(env.PgBackup))
+	os.Setenv(env.PgBackup, root)
+
+	name := time.Now().Format(snapshotLayout)
+	assert.Nil(os.Mkdir(filepath.Join(root, name), 0700))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := New(ctx).(*cluster)
+
+	// the job may have just moved the data directory into the snapshot
+	c.job = &BackupJob{ID: "1", Status: BackupJobRunning}
+	assert.ErrorIs(c.DeleteSnapshot(ctx, name), ErrBackupInProgress)
+	_, err = os.Stat(filepath.Join(root, name))
+	assert.Nil(err)
+
+	c.job.Status = BackupJobSucceeded
+	assert.Nil(c.DeleteSnapshot(ctx, name))
+}
@@ -0,0 +1,366 @@
+package pg
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/logging"
+)
+
+const (
+	// DefaultPostmasterLoggerName is the default name for the postmaster
+	// output logger.
+	DefaultPostmasterLoggerName = "postgres"
+
+	// DefaultStartTimeout is the default timeout for the supervised
+	// postmaster to be ready.
+	DefaultStartTimeout = 60 * time.Second
+
+	// DefaultStopTimeout is the default timeout for the supervised postmaster
+	// to shut down before it is killed.
+	DefaultStopTimeout = 60 * time.Second
+
+	postmasterPidFile  = "postmaster.pid"
+	pidFileStatusLine  = 7
+	superviseInterval  = time.Second
+	maxRestartDelay    = 30 * time.Second
+	stableRunningDelay = time.Minute
+)
+
+// ErrStartTimeout is returned when the supervised postmaster is not ready
+// within the start timeout.
+var ErrStartTimeout = errors.New("start timeout")
+
+// supervisor runs the postmaster as a child process and restarts it with
+// backoff if it exits unexpectedly.
+type supervisor struct {
+	logger       logging.Logger
+	pgLogger     logging.Logger
+	binDir       string
+	dataDir      string
+	startTimeout time.Duration
+	stopTimeout  time.Duration
+	done         chan struct{}
+
+	mu        sync.Mutex // protects following fields
+	enabled   bool
+	cmd       *exec.Cmd
+	exited    chan struct{}
+	startedAt time.Time
+	restarts  int
+	nextStart time.Time
+}
+
+func newSupervisor(logger logging.Logger, binDir, dataDir string) *supervisor {
+	return &supervisor{
+		logger:       logger,
+		pgLogger:     logging.NewLogger(DefaultPostmasterLoggerName),
+		binDir:       binDir,
+		dataDir:      dataDir,
+		startTimeout: DefaultStartTimeout,
+		stopTimeout:  DefaultStopTimeout,
+		done:         make(chan struct{}),
+	}
+}
+
+// run supervises the postmaster until the context is done, then stops it and
+// closes the done channel.
+func (s *supervisor) run(ctx context.Context) {
+	defer close(s.done)
+	t := time.NewTicker(superviseInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.stop(); err != nil {
+				s.logger.Error("postmaster stop error", "message", err)
+			}
+			return
+		case <-t.C:
+			s.supervise()
+		}
+	}
+}
+
+// supervise restarts the postmaster if it should be running but it is not.
+func (s *supervisor) supervise() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.enabled || s.runningLocked() || time.Now().Before(s.nextStart) {
+		return
+	}
+	s.logger.Warn("restarting postmaster", "restarts", s.restarts)
+	if err := s.spawnLocked(); err != nil {
+		s.logger.Error("postmaster start error", "message", err)
+		s.backoffLocked()
+	}
+}
+
+// start starts the postmaster and waits for it to be ready.
+func (s *supervisor) start() error {
+	s.mu.Lock()
+	s.enabled = true
+	s.restarts = 0
+	s.nextStart = time.Time{}
+	if !s.runningLocked() {
+		if err := s.spawnLocked(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	s.mu.Unlock()
+	return s.awaitReady()
+}
+
+// stop stops the postmaster with the fast shutdown mode and waits for it to
+// exit. The postmaster is killed if it does not exit within the stop timeout.
+func (s *supervisor) stop() error {
+	s.mu.Lock()
+	s.enabled = false
+	cmd, exited := s.cmd, s.exited
+	s.mu.Unlock()
+
+	if cmd == nil {
+		// not started by the supervisor, e.g. by the entry point
+		pid, err := s.pid()
+		if err != nil || !postmasterRunning(s.dataDir, pid) {
+			return nil
+		}
+		s.logger.Warn("stopping postmaster", "pid", pid)
+		if err := syscall.Kill(pid, syscall.SIGINT); err != nil {
+			return err
+		}
+		deadline := time.Now().Add(s.stopTimeout)
+		killed := false
+		for processAlive(pid) {
+			if !killed && time.Now().After(deadline) {
+				s.logger.Error("postmaster has not stopped, killing", "pid", pid)
+				if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+					return err
+				}
+				// the data directory is not released until it has exited
+				killed = true
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		return nil
+	}
+
+	s.logger.Warn("stopping postmaster", "pid", cmd.Process.Pid)
+	if err := cmd.Process.Signal(syscall.SIGINT); err != nil {
+		return err
+	}
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(s.stopTimeout):
+		s.logger.Error("postmaster has not stopped, killing", "pid", cmd.Process.Pid)
+		// the backends too, they hold the output pipes
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+			return err
+		}
+		// the data directory is not released until it has exited
+		<-exited
+		return nil
+	}
+}
+
+// running returns true if the postmaster is running, whether it has been
+// started by the supervisor or not.
+func (s *supervisor) running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runningLocked()
+}
+
+func (s *supervisor) runningLocked() bool {
+	if s.cmd != nil {
+		return true
+	}
+	pid, err := s.pid()
+	return err == nil && postmasterRunning(s.dataDir, pid)
+}
+
+func (s *supervisor) spawnLocked() error {
+	/* #nosec */
+	cmd := exec.Command(filepath.Join(s.binDir, "postgres"), "-D", s.dataDir)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	s.logger.Info("postmaster started", "pid", cmd.Process.Pid)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go s.pipe(&wg, stdout)
+	go s.pipe(&wg, stderr)
+
+	exited := make(chan struct{})
+	s.cmd = cmd
+	s.exited = exited
+	s.startedAt = time.Now()
+	go func() {
+		wg.Wait()
+		err := cmd.Wait()
+		close(exited)
+		s.exit(cmd, err)
+	}()
+	return nil
+}
+
+// exit handles the postmaster exit.
+func (s *supervisor) exit(cmd *exec.Cmd, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cmd != cmd {
+		return
+	}
+	s.cmd = nil
+	s.exited = nil
+	if !s.enabled {
+		s.logger.Info("postmaster stopped", "pid", cmd.Process.Pid)
+		return
+	}
+	s.logger.Error("postmaster exited unexpectedly", "pid", cmd.Process.Pid, "message", err)
+	if time.Since(s.startedAt) > stableRunningDelay {
+		s.restarts = 0
+	}
+	s.backoffLocked()
+}
+
+func (s *supervisor) backoffLocked() {
+	d := superviseInterval << uint(s.restarts)
+	if d <= 0 || d > maxRestartDelay {
+		d = maxRestartDelay
+	}
+	s.restarts++
+	s.nextStart = time.Now().Add(d)
+	s.logger.Warn("postmaster restart scheduled", "in", d)
+}
+
+func (s *supervisor) pipe(wg *sync.WaitGroup, r io.Reader) {
+	defer wg.Done()
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		s.pgLogger.Info(sc.Text())
+	}
+}
+
+// awaitReady waits for the postmaster to report it is ready to accept
+// connections in postmaster.pid.
+func (s *supervisor) awaitReady() error {
+	deadline := time.Now().Add(s.startTimeout)
+	for time.Now().Before(deadline) {
+		status, err := s.status()
+		if err == nil && (status == "ready" || status == "standby") {
+			return nil
+		}
+		if !s.running() {
+			return errors.New("postmaster exited")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("%w: %v", ErrStartTimeout, s.startTimeout)
+}
+
+func (s *supervisor) readPidFile() ([]string, error) {
+	return readPidFile(s.dataDir)
+}
+
+func readPidFile(dataDir string) ([]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dataDir, postmasterPidFile))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(string(b), "\n"), nil
+}
+
+// postmasterPid returns the postmaster PID from postmaster.pid of the data
+// directory.
+func postmasterPid(dataDir string) (int, error) {
+	lines, err := readPidFile(dataDir)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(lines[0]))
+}
+
+// pid returns the postmaster PID from postmaster.pid.
+func (s *supervisor) pid() (int, error) {
+	return postmasterPid(s.dataDir)
+}
+
+// status returns the postmaster status from postmaster.pid.
+func (s *supervisor) status() (string, error) {
+	lines, err := s.readPidFile()
+	if err != nil {
+		return "", err
+	}
+	if len(lines) <= pidFileStatusLine {
+		return "", nil
+	}
+	return strings.TrimSpace(lines[pidFileStatusLine]), nil
+}
+
+// postmasterRunning reports whether the PID is the running postmaster of the
+// data directory. The PID from a stale postmaster.pid may have been reused by
+// another process, so the process must run postgres in the data directory,
+// which the postmaster changes to.
+func postmasterRunning(dataDir string, pid int) bool {
+	if !processAlive(pid) {
+		return false
+	}
+	if _, err := os.Stat("/proc/self"); err != nil {
+		// no procfs, trust the PID
+		return true
+	}
+	proc := filepath.Join("/proc", strconv.Itoa(pid))
+	cmdline, err := ioutil.ReadFile(filepath.Join(proc, "cmdline"))
+	if err != nil {
+		return false
+	}
+	postgres := false
+	for _, arg := range strings.Split(string(cmdline), "\x00") {
+		if b := filepath.Base(arg); b == "postgres" || b == "postmaster" {
+			postgres = true
+			break
+		}
+	}
+	if !postgres {
+		return false
+	}
+	cwd, err := os.Readlink(filepath.Join(proc, "cwd"))
+	if err != nil {
+		return false
+	}
+	dir, err := filepath.EvalSymlinks(dataDir)
+	return err == nil && cwd == dir
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,132 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vontikov/pgcluster/internal/logging"
+)
+
+// fakePostgres changes to the data directory and writes postmaster.pid like
+// the postmaster does, then waits for a signal.
+const fakePostgres = `#!/bin/sh
+cd "$2" || exit 1
+trap 'rm -f "$2/postmaster.pid"; exit 0' INT
+printf '%s\n%s\n0\n5432\n/tmp\nlocalhost\n0 0\nready\n' $$ "$2" > "$2/postmaster.pid"
+echo "database system is ready to accept connections"
+while true; do sleep 0.1; done
+`
+
+func TestSupervisor(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "supervisor")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	binDir := filepath.Join(dir, "bin")
+	dataDir := filepath.Join(dir, "data")
+	assert.Nil(os.Mkdir(binDir, 0700))
+	assert.Nil(os.Mkdir(dataDir, 0700))
+	assert.Nil(ioutil.WriteFile(filepath.Join(binDir, "postgres"), []byte(fakePostgres), 0700))
+
+	s := newSupervisor(logging.NewLogger("test"), binDir, dataDir)
+	s.startTimeout = 5 * time.Second
+	s.stopTimeout = 5 * time.Second
+
+	assert.Nil(s.start())
+	assert.True(s.running())
+	pid, err := s.pid()
+	assert.Nil(err)
+
+	// crash
+	s.mu.Lock()
+	assert.Nil(s.cmd.Process.Kill())
+	s.mu.Unlock()
+	assert.Eventually(func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.cmd == nil && s.restarts == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(processAlive(pid))
+
+	// restarted with backoff
+	assert.Eventually(func() bool {
+		s.supervise()
+		status, _ := s.status()
+		npid, _ := s.pid()
+		return status == "ready" && npid != pid
+	}, 5*time.Second, 100*time.Millisecond)
+
+	assert.Nil(s.stop())
+	assert.False(s.running())
+
+	// not restarted once stopped
+	s.supervise()
+	assert.False(s.running())
+
+	// stopped when the context is done
+	assert.Nil(s.start())
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.run(ctx)
+	cancel()
+	<-s.done
+	assert.False(s.running())
+}
+
+func TestSupervisorStalePidFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "supervisor")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// the PID has been reused by another process
+	pidFile := fmt.Sprintf("%d\n%s\n", os.Getpid(), dir)
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, postmasterPidFile), []byte(pidFile), 0600))
+
+	s := newSupervisor(logging.NewLogger("test"), filepath.Join(dir, "bin"), dir)
+	pid, err := s.pid()
+	assert.Nil(err)
+	assert.True(processAlive(pid))
+	assert.False(s.running())
+
+	// not signaled
+	assert.Nil(s.stop())
+}
+
+func TestSupervisorKill(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "supervisor")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	binDir := filepath.Join(dir, "bin")
+	dataDir := filepath.Join(dir, "data")
+	assert.Nil(os.Mkdir(binDir, 0700))
+	assert.Nil(os.Mkdir(dataDir, 0700))
+	// the fast shutdown is ignored
+	stuck := strings.Replace(fakePostgres, "trap 'rm -f \"$2/postmaster.pid\"; exit 0' INT", "trap '' INT", 1)
+	assert.NotEqual(fakePostgres, stuck)
+	assert.Nil(ioutil.WriteFile(filepath.Join(binDir, "postgres"), []byte(stuck), 0700))
+
+	s := newSupervisor(logging.NewLogger("test"), binDir, dataDir)
+	s.startTimeout = 5 * time.Second
+	s.stopTimeout = 200 * time.Millisecond
+
+	assert.Nil(s.start())
+	pid, err := s.pid()
+	assert.Nil(err)
+
+	// killed and exited once stop returns
+	assert.Nil(s.stop())
+	assert.False(processAlive(pid))
+}
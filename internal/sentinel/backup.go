@@ -0,0 +1,52 @@
+package sentinel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/vontikov/pgcluster/internal/pg"
+)
+
+// ErrInvalidBackupSource is returned when a backup job source is not valid.
+var ErrInvalidBackupSource = errors.New("invalid backup source")
+
+// StartBackupJob starts reinitialising the instance from the host:port, or
+// from the master if the host is empty, in the background. The master is never
+// reinitialised. The instance is not checked while the job runs, so the job
+// stopping and starting it is not taken for a failure. The job waits for the
+// check in progress, if any, but it is returned right away.
+func (w *Sentinel) StartBackupJob(ctx context.Context, host string, port int) (*pg.BackupJob, error) {
+	if w.State() == Master {
+		return nil, fmt.Errorf("%w: the instance is the master", pg.ErrNotStandby)
+	}
+	if host == "" {
+		mi, err := w.readMasterInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if mi == nil {
+			return nil, fmt.Errorf("%w: host is not set and there is no master", ErrInvalidBackupSource)
+		}
+		host, port = mi.Host, mi.Port
+	}
+	if host == w.hostname {
+		return nil, fmt.Errorf("%w: %s is the instance itself", ErrInvalidBackupSource, host)
+	}
+	return w.c.StartBackupJob(ctx, host, port, func() {
+		// the checks started since skip the running job
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	})
+}
+
+// BackupJob returns the latest backup job of the instance or nil.
+func (w *Sentinel) BackupJob(ctx context.Context) *pg.BackupJob {
+	return w.c.BackupJob(ctx)
+}
+
+// backupRunning reports whether a backup job is running on the instance.
+func (w *Sentinel) backupRunning(ctx context.Context) bool {
+	job := w.c.BackupJob(ctx)
+	return job != nil && job.Status == pg.BackupJobRunning
+}
@@ -0,0 +1,241 @@
+package sentinel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/pg"
+)
+
+var dictKeyConfig = []byte("config")
+
+// ErrInvalidConfig is returned when the cluster configuration is not valid.
+var ErrInvalidConfig = errors.New("invalid config")
+
+// reservedParameters are managed by the agent and may not be configured.
+var reservedParameters = map[string]bool{
+	"default_transaction_read_only": true,
+	"primary_conninfo":              true,
+	"primary_slot_name":             true,
+	"promote_trigger_file":          true,
+}
+
+// ClusterConfig is the PostgreSQL configuration shared by the cluster members.
+type ClusterConfig struct {
+	// Parameters are applied on every member.
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	// Nodes are the parameters overridden per member name.
+	Nodes map[string]map[string]string `json:"nodes,omitempty"`
+}
+
+func (c *ClusterConfig) validate() error {
+	check := func(params map[string]string) error {
+		for name := range params {
+			if !pg.ValidParameterName(name) {
+				return fmt.Errorf("%w: parameter name %q", ErrInvalidConfig, name)
+			}
+			if reservedParameters[name] {
+				return fmt.Errorf("%w: parameter %q is managed by the agent", ErrInvalidConfig, name)
+			}
+		}
+		return nil
+	}
+	if err := check(c.Parameters); err != nil {
+		return err
+	}
+	for _, params := range c.Nodes {
+		if err := check(params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// effective returns the parameters of the member.
+func (c *ClusterConfig) effective(name string) map[string]string {
+	r := make(map[string]string, len(c.Parameters))
+	for k, v := range c.Parameters {
+		r[k] = v
+	}
+	for k, v := range c.Nodes[name] {
+		r[k] = v
+	}
+	return r
+}
+
+// Config returns the cluster configuration.
+func (w *Sentinel) Config(ctx context.Context) (*ClusterConfig, error) {
+	c, _, err := w.readConfig(ctx)
+	return c, err
+}
+
+// readConfig returns the cluster configuration and whether it is stored.
+func (w *Sentinel) readConfig(ctx context.Context) (*ClusterConfig, bool, error) {
+	payload, err := w.storage.DictionaryGet(ctx, dictKeyConfig)
+	if err != nil {
+		return nil, false, err
+	}
+	var c ClusterConfig
+	if payload == nil {
+		return &c, false, nil
+	}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, false, err
+	}
+	return &c, true, nil
+}
+
+// PatchConfig updates the cluster configuration with the JSON merge patch
+// (RFC 7386): a null value removes the parameter, or all the overrides of the
+// node.
+func (w *Sentinel) PatchConfig(ctx context.Context, patch []byte) (*ClusterConfig, error) {
+	var p map[string]interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	payload, err := w.storage.DictionaryGet(ctx, dictKeyConfig)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]interface{}{}
+	if payload != nil {
+		if err := json.Unmarshal(payload, &doc); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := json.Marshal(mergePatch(doc, p))
+	if err != nil {
+		return nil, err
+	}
+	var c ClusterConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	if payload, err = json.Marshal(&c); err != nil {
+		return nil, err
+	}
+	w.logger.Warn("updating cluster config", "config", string(payload))
+	if err := w.storage.DictionaryPut(ctx, dictKeyConfig, payload); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func mergePatch(doc, patch map[string]interface{}) map[string]interface{} {
+	for k, v := range patch {
+		if v == nil {
+			delete(doc, k)
+			continue
+		}
+		if pv, ok := v.(map[string]interface{}); ok {
+			dv, ok := doc[k].(map[string]interface{})
+			if !ok {
+				dv = map[string]interface{}{}
+			}
+			doc[k] = mergePatch(dv, pv)
+			continue
+		}
+		doc[k] = v
+	}
+	return doc
+}
+
+// applyConfig makes the ALTER SYSTEM settings of the node match its
+// parameters of the cluster configuration, once it is stored. The actual
+// settings are compared, as they are replaced when the node is resynchronized
+// from another one. A parameter failed to be set or reset is not retried until
+// its value changes, e.g. an unknown parameter would fail every time.
+func (w *Sentinel) applyConfig(ctx context.Context) error {
+	c, stored, err := w.readConfig(ctx)
+	if err != nil || !stored {
+		return err
+	}
+	params := c.effective(w.hostname)
+	actual, err := w.c.SystemSettings(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := make(map[string]string)
+	set := make(map[string]string)
+	for k, v := range params {
+		if a, ok := actual[k]; ok && a == v {
+			continue
+		}
+		if f, ok := w.configFailed[k]; ok && f == v {
+			failed[k] = v
+			continue
+		}
+		set[k] = v
+	}
+	var reset []string
+	for k, a := range actual {
+		if _, ok := params[k]; ok || reservedParameters[k] {
+			continue
+		}
+		if f, ok := w.configFailed[k]; ok && f == a {
+			failed[k] = a
+			continue
+		}
+		reset = append(reset, k)
+	}
+	sort.Strings(reset)
+	w.configFailed = failed
+
+	var applyErr error
+	if len(set) > 0 || len(reset) > 0 {
+		applyErr = w.c.AlterSystem(ctx, set, reset)
+		var perr *pg.ParameterError
+		if errors.As(applyErr, &perr) {
+			for k := range perr.Errors {
+				if v, ok := set[k]; ok {
+					w.configFailed[k] = v
+				} else {
+					w.configFailed[k] = actual[k]
+				}
+			}
+		}
+		w.smu.Lock()
+		w.configError = ""
+		if applyErr != nil {
+			w.configError = applyErr.Error()
+		}
+		w.configApplied = time.Now()
+		w.smu.Unlock()
+	} else {
+		w.smu.Lock()
+		if len(failed) == 0 {
+			w.configError = ""
+		}
+		pending := len(w.pendingRestart)
+		w.smu.Unlock()
+		if pending == 0 {
+			return nil
+		}
+	}
+
+	// pending until restarted, so checked until cleared
+	pending, err := w.c.PendingRestart(ctx)
+	if err != nil {
+		return err
+	}
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	if len(pending) > 0 && !reflect.DeepEqual(pending, w.pendingRestart) {
+		w.logger.Warn("parameters pending restart", "names", pending)
+	}
+	w.pendingRestart = pending
+	return applyErr
+}
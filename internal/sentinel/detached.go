@@ -0,0 +1,157 @@
+package sentinel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/hook"
+	"github.com/vontikov/pgcluster/internal/util"
+)
+
+const (
+	// DefaultReinitAfter is the default number of failed attempts to follow
+	// the master after which a detached instance is reinitialised from the
+	// master.
+	DefaultReinitAfter = 3
+
+	maxRecoveryDelay = time.Minute
+)
+
+// errNoMaster is returned when a detached instance has acquired the master
+// mutex, i.e. there is no master to follow.
+var errNoMaster = errors.New("no master to follow")
+
+// WithReinitAfter sets the number of failed attempts to follow the master after
+// which a detached instance is reinitialised from the master.
+func WithReinitAfter(v string) Option {
+	n, err := strconv.Atoi(v)
+	util.PanicOnError(err)
+	return func(w *Sentinel) { w.reinitAfter = n }
+}
+
+// detach detaches the instance from the cluster. It must be called under w.mu.
+func (w *Sentinel) detach(reason string, err error) {
+	if err != nil {
+		reason = fmt.Sprintf("%s: %v", reason, err)
+	}
+	w.logger.Error("detached", "reason", reason)
+	w.setState(Detached)
+
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	w.detachedReason = reason
+	if w.detachedSince.IsZero() {
+		w.detachedSince = time.Now()
+	}
+}
+
+// recoveryFailed records the failed attempt to recover and schedules the next
+// one with exponential backoff.
+func (w *Sentinel) recoveryFailed(err error) error {
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	w.recoveryAttempts++
+	d := w.interval << uint(w.recoveryAttempts)
+	if d <= 0 || d > maxRecoveryDelay {
+		d = maxRecoveryDelay
+	}
+	w.nextRecovery = time.Now().Add(d)
+	w.detachedReason = err.Error()
+	w.logger.Warn("recovery failed", "attempt", w.recoveryAttempts, "retry in", d, "message", err)
+	return err
+}
+
+func (w *Sentinel) recovered() {
+	w.setState(Replica)
+
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	w.logger.Warn("recovered", "attempts", w.recoveryAttempts+1)
+	w.detachedReason = ""
+	w.detachedSince = time.Time{}
+	w.recoveryAttempts = 0
+	w.nextRecovery = time.Time{}
+}
+
+// checkDetached tries to make the detached instance follow the master. The
+// attempts are retried with backoff, and after reinitAfter failed attempts the
+// instance is reinitialised from the master.
+func (w *Sentinel) checkDetached(ctx context.Context) error {
+	if w.Paused() {
+		return nil
+	}
+
+	w.smu.Lock()
+	attempts, next := w.recoveryAttempts, w.nextRecovery
+	w.smu.Unlock()
+	if time.Now().Before(next) {
+		w.logger.Trace("recovery is delayed", "until", next)
+		return nil
+	}
+
+	locked, err := w.storage.MutexTryLock(ctx)
+	if err != nil {
+		w.logger.Warn("mutex error", "message", err)
+		return err
+	}
+	if locked {
+		// the state of a detached instance is unknown, let a replica promote
+		w.logger.Warn("releasing the master mutex acquired while detached")
+		if err := w.storage.MutexUnlock(ctx); err != nil {
+			return w.recoveryFailed(fmt.Errorf("failed to release the master mutex: %w", err))
+		}
+		return w.recoveryFailed(errNoMaster)
+	}
+
+	// make follow resync even if the master has not changed
+	w.masterInfo = nil
+	if w.reinitAfter > 0 && attempts >= w.reinitAfter {
+		err = w.reinit(ctx)
+	} else {
+		err = w.follow(ctx)
+	}
+	if err != nil {
+		return w.recoveryFailed(err)
+	}
+	w.recovered()
+	return nil
+}
+
+// reinit recreates the instance from the master skipping the rewind.
+func (w *Sentinel) reinit(ctx context.Context) error {
+	master, err := w.getMaster(ctx)
+	if err != nil {
+		return err
+	}
+	w.logger.Warn("reinitialising from", "host", master.Host, "port", master.Port)
+
+	w.setTerm(master.Term)
+	if err := w.stop(ctx); err != nil {
+		return fmt.Errorf("reinit: %w", err)
+	}
+	if err := w.c.Backup(ctx, master.Host, master.Port); err != nil {
+		return fmt.Errorf("reinit: %w", err)
+	}
+	if err := w.c.Start(ctx); err != nil {
+		return fmt.Errorf("reinit: %w", err)
+	}
+	w.masterInfo = master
+	w.fire(hook.OnFollow)
+	return nil
+}
+
+// stop stops the local PostgreSQL. It is not an error if it is not running.
+func (w *Sentinel) stop(ctx context.Context) error {
+	err := w.c.Stop(ctx)
+	if err == nil {
+		return nil
+	}
+	if r, aerr := w.c.Alive(ctx); aerr == nil && r {
+		return err
+	}
+	w.logger.Warn("stop failed, instance is not running", "message", err)
+	return nil
+}
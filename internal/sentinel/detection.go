@@ -0,0 +1,115 @@
+package sentinel
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/util"
+)
+
+const (
+	// DefaultFailureThreshold is the default number of consecutive failed
+	// probes after which the instance is considered down.
+	DefaultFailureThreshold = 1
+
+	// DefaultProbeTimeout is the default timeout for a liveness probe.
+	DefaultProbeTimeout = 5 * time.Second
+
+	// DefaultMinDownTime is the default minimum time the instance has to be
+	// down to be considered down.
+	DefaultMinDownTime time.Duration = 0
+)
+
+// WithFailureThreshold sets the number of consecutive failed probes after
+// which the instance is considered down.
+func WithFailureThreshold(v string) Option {
+	n, err := strconv.Atoi(v)
+	util.PanicOnError(err)
+	return func(w *Sentinel) { w.failureThreshold = n }
+}
+
+// WithProbeTimeout sets the timeout for a liveness probe.
+func WithProbeTimeout(v string) Option {
+	d, err := time.ParseDuration(v)
+	util.PanicOnError(err)
+	return func(w *Sentinel) { w.probeTimeout = d }
+}
+
+// WithMinDownTime sets the minimum time the instance has to be down, since the
+// first failed probe, to be considered down.
+func WithMinDownTime(v string) Option {
+	d, err := time.ParseDuration(v)
+	util.PanicOnError(err)
+	return func(w *Sentinel) { w.minDownTime = d }
+}
+
+// probe probes the local PostgreSQL and records the result. It must be called
+// under w.mu.
+func (w *Sentinel) probe(ctx context.Context) bool {
+	w.alive = w.probeAlive(ctx)
+
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	if w.alive {
+		if w.probeFailures > 0 {
+			w.logger.Info("instance is up again", "failed probes", w.probeFailures)
+		}
+		w.probeFailures = 0
+		w.downSince = time.Time{}
+		return true
+	}
+	if w.probeFailures == 0 {
+		w.downSince = time.Now()
+	}
+	w.probeFailures++
+	return false
+}
+
+func (w *Sentinel) probeAlive(ctx context.Context) bool {
+	if w.probeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.probeTimeout)
+		defer cancel()
+	}
+	r, err := w.c.Alive(ctx)
+	if ctx.Err() == context.DeadlineExceeded {
+		w.logger.Warn("probe timeout", "timeout", w.probeTimeout)
+		return false
+	}
+	return err == nil && r
+}
+
+// down reports whether the failed probes have exceeded the failure threshold
+// and the minimum down time.
+func (w *Sentinel) down() bool {
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	if w.probeFailures == 0 || w.probeFailures < w.failureThreshold {
+		return false
+	}
+	return time.Since(w.downSince) >= w.minDownTime
+}
+
+// masterDown records whether a running master is registered and reports
+// whether it has been missing for the failure threshold and the minimum down
+// time, the same as the instance itself. It must be called under w.mu.
+func (w *Sentinel) masterDown(members []*Member) bool {
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	for _, m := range members {
+		if m.Name != w.hostname && m.Role == Master.String() && m.State == MemberRunning {
+			w.masterFailures = 0
+			w.masterDownSince = time.Time{}
+			return false
+		}
+	}
+	if w.masterFailures == 0 {
+		w.masterDownSince = time.Now()
+	}
+	w.masterFailures++
+	if w.masterFailures < w.failureThreshold {
+		return false
+	}
+	return time.Since(w.masterDownSince) >= w.minDownTime
+}
@@ -0,0 +1,121 @@
+package sentinel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/vontikov/pgcluster/internal/util"
+)
+
+// Escalation steps.
+const (
+	EscalationUnhealthy = "unhealthy"
+	EscalationStop      = "stop"
+	EscalationExit      = "exit"
+)
+
+// ErrEscalated is returned by Escalate when the process should exit.
+var ErrEscalated = errors.New("check failures escalated")
+
+// WithUnhealthyAfter sets the number of consecutive check failures after which
+// the instance is marked unhealthy and is not considered for failover. Zero
+// disables the step.
+func WithUnhealthyAfter(v string) Option {
+	n, err := strconv.Atoi(v)
+	util.PanicOnError(err)
+	return func(w *Sentinel) { w.unhealthyAfter = n }
+}
+
+// WithStopAfter sets the number of consecutive check failures after which the
+// local PostgreSQL is stopped. Zero disables the step.
+func WithStopAfter(v string) Option {
+	n, err := strconv.Atoi(v)
+	util.PanicOnError(err)
+	return func(w *Sentinel) { w.stopAfter = n }
+}
+
+// WithExitAfter sets the number of consecutive check failures after which
+// Escalate returns ErrEscalated. Zero disables the step.
+func WithExitAfter(v string) Option {
+	n, err := strconv.Atoi(v)
+	util.PanicOnError(err)
+	return func(w *Sentinel) { w.exitAfter = n }
+}
+
+// Unhealthy returns true if the instance has been marked unhealthy.
+func (w *Sentinel) Unhealthy() bool {
+	return atomic.LoadInt32(&w.unhealthy) == 1
+}
+
+func (w *Sentinel) setUnhealthy(v bool) {
+	var i int32
+	if v {
+		i = 1
+	}
+	atomic.StoreInt32(&w.unhealthy, i)
+}
+
+// Escalate applies the escalation policy to the errors received from Err()
+// until the context is done. It returns ErrEscalated if the process should
+// exit.
+func (w *Sentinel) Escalate(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-w.errChan:
+			if !ok {
+				return nil
+			}
+			if err := w.escalate(ctx, err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type escalationStep struct {
+	name  string
+	after int
+	apply func(context.Context) error
+}
+
+func (w *Sentinel) escalate(ctx context.Context, cause error) error {
+	steps := []escalationStep{
+		{EscalationUnhealthy, w.unhealthyAfter, func(context.Context) error {
+			w.setUnhealthy(true)
+			return nil
+		}},
+		{EscalationStop, w.stopAfter, w.c.Stop},
+		{EscalationExit, w.exitAfter, func(context.Context) error {
+			return fmt.Errorf("%w: %v", ErrEscalated, cause)
+		}},
+	}
+
+	w.smu.Lock()
+	n := w.consecutiveErrors
+	due := make([]escalationStep, 0, len(steps))
+	for i, s := range steps {
+		if s.after <= 0 || n < s.after || w.escalationLevel > i {
+			continue
+		}
+		w.escalationLevel = i + 1
+		w.escalations[s.name]++
+		due = append(due, s)
+	}
+	w.smu.Unlock()
+
+	for _, s := range due {
+		w.logger.Error("escalating", "step", s.name, "failures", n, "message", cause)
+		if err := s.apply(ctx); err != nil {
+			if errors.Is(err, ErrEscalated) {
+				return err
+			}
+			w.logger.Error("escalation step failed", "step", s.name, "message", err)
+		}
+	}
+	return nil
+}
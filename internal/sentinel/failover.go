@@ -0,0 +1,99 @@
+package sentinel
+
+import (
+	"context"
+
+	"github.com/vontikov/pgcluster/internal/pg"
+)
+
+// promotionCandidate reports whether the instance is to compete for the master
+// mutex. While a switchover is in progress only its candidate competes, the
+// master has checked it is caught up, so the priorities are not considered.
+func (w *Sentinel) promotionCandidate(ctx context.Context, self *Member) (bool, error) {
+	si, err := w.GetSwitchover(ctx)
+	if err != nil {
+		return false, err
+	}
+	if si != nil {
+		return si.Candidate == w.hostname && self.standby() && !self.Unhealthy, nil
+	}
+	return w.failoverCandidate(ctx, self)
+}
+
+// failoverCandidate reports whether the master is down, and the instance is
+// advanced enough and has priority enough to compete for the master mutex.
+func (w *Sentinel) failoverCandidate(ctx context.Context, self *Member) (bool, error) {
+	if !self.standby() {
+		// e.g. a former master which has not followed yet
+		return false, nil
+	}
+	if self.noFailover() {
+		w.logger.Trace("failover is disabled by tag")
+		return false, nil
+	}
+	if self.Unhealthy {
+		w.logger.Trace("failover is disabled, instance is unhealthy")
+		return false, nil
+	}
+
+	members, err := w.Members(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !w.masterDown(members) {
+		w.logger.Trace("master is not down")
+		return false, nil
+	}
+	others := make([]candidate, 0, len(members))
+	for _, m := range members {
+		if m.Name != self.Name && m.standby() && !m.noFailover() && !m.Unhealthy {
+			others = append(others, candidate{m.LSN, m.failoverPriority()})
+		}
+	}
+
+	r := isFailoverCandidate(candidate{self.LSN, self.failoverPriority()}, others, w.maxLag)
+	if !r && w.logger.IsTrace() {
+		w.logger.Trace("not a failover candidate", "position", self.LSN)
+	}
+	return r, nil
+}
+
+type candidate struct {
+	lsn      pg.LSN
+	priority int
+}
+
+// isFailoverCandidate returns true if the candidate self is not behind the
+// most advanced of the candidates by more than maxLag bytes, and none of the
+// others which are not behind has a higher priority.
+func isFailoverCandidate(self candidate, others []candidate, maxLag uint64) bool {
+	max := self.lsn
+	for _, o := range others {
+		if o.lsn > max {
+			max = o.lsn
+		}
+	}
+	if max.Distance(self.lsn) > maxLag {
+		return false
+	}
+	for _, o := range others {
+		if o.priority > self.priority && max.Distance(o.lsn) <= maxLag {
+			return false
+		}
+	}
+	return true
+}
+
+// cloneSource returns a running replica tagged as the clone source, or nil.
+func (w *Sentinel) cloneSource(ctx context.Context, master *MasterInfo) (*Member, error) {
+	members, err := w.Members(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		if m.Name != w.hostname && m.Host != master.Host && m.standby() && !m.Unhealthy && m.cloneFrom() {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
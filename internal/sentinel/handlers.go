@@ -0,0 +1,262 @@
+package sentinel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/vontikov/pgcluster/internal/pg"
+)
+
+// Handlers returns the HTTP handlers to manage the cluster.
+func Handlers(s *Sentinel) map[string]func(http.ResponseWriter, *http.Request) {
+	return map[string]func(http.ResponseWriter, *http.Request){
+		"/cluster/config":     configHandler(s),
+		"/cluster/hba":        hbaHandler(s),
+		"/cluster/members":    membersHandler(s),
+		"/cluster/pause":      pauseHandler(s),
+		"/cluster/resume":     resumeHandler(s),
+		"/cluster/switchover": switchoverHandler(s),
+		"/sentinel/status":    statusHandler(s),
+		"/sentinel/reset":     resetHandler(s),
+		"/pg/backup":          backupHandler(s),
+	}
+}
+
+func pauseHandler(s *Sentinel) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if err := s.Pause(r.Context()); err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+		default:
+			writeError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"paused": s.Paused()})
+	}
+}
+
+func resumeHandler(s *Sentinel) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+		if err := s.Resume(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"paused": s.Paused()})
+	}
+}
+
+func configHandler(s *Sentinel) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			c, err := s.Config(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, c)
+		case http.MethodPatch:
+			patch, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			c, err := s.PatchConfig(r.Context(), patch)
+			if err != nil {
+				code := http.StatusInternalServerError
+				if errors.Is(err, ErrInvalidConfig) {
+					code = http.StatusBadRequest
+				}
+				writeError(w, code, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, c)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, nil)
+		}
+	}
+}
+
+func hbaHandler(s *Sentinel) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			rules, err := s.effectiveHBA(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if rules == nil {
+				writeError(w, http.StatusNotFound, errors.New("pg_hba.conf is not managed"))
+				return
+			}
+			writeJSON(w, http.StatusOK, rules)
+		case http.MethodPut:
+			var rules []*pg.HBARule
+			if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			if rules == nil {
+				rules = []*pg.HBARule{}
+			}
+			if err := s.SetHBARules(r.Context(), rules); err != nil {
+				code := http.StatusInternalServerError
+				if errors.Is(err, pg.ErrInvalidHBA) {
+					code = http.StatusBadRequest
+				}
+				writeError(w, code, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, rules)
+		case http.MethodDelete:
+			if err := s.SetHBARules(r.Context(), nil); err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, nil)
+		}
+	}
+}
+
+func membersHandler(s *Sentinel) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+		members, err := s.Members(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, members)
+	}
+}
+
+func switchoverHandler(s *Sentinel) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			si, err := s.GetSwitchover(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if si == nil {
+				writeError(w, http.StatusNotFound, errors.New("no switchover in progress"))
+				return
+			}
+			writeJSON(w, http.StatusOK, si)
+		case http.MethodPost:
+			si, err := s.Switchover(r.Context(), r.URL.Query().Get("candidate"))
+			if err != nil {
+				code := http.StatusInternalServerError
+				if errors.Is(err, ErrNoCandidate) || errors.Is(err, ErrInvalidCandidate) {
+					code = http.StatusBadRequest
+				} else if errors.Is(err, ErrSwitchoverInProgress) || errors.Is(err, ErrPaused) {
+					code = http.StatusConflict
+				}
+				writeError(w, code, err)
+				return
+			}
+			writeJSON(w, http.StatusAccepted, si)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, nil)
+		}
+	}
+}
+
+func backupHandler(s *Sentinel) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			job := s.BackupJob(r.Context())
+			if job == nil || (r.URL.Query().Get("id") != "" && r.URL.Query().Get("id") != job.ID) {
+				writeError(w, http.StatusNotFound, errors.New("backup job not found"))
+				return
+			}
+			writeJSON(w, http.StatusOK, job)
+		case http.MethodPost:
+			port := pg.DefaultPort
+			if v := r.URL.Query().Get("port"); v != "" {
+				p, err := strconv.Atoi(v)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, fmt.Errorf("invalid port: %q", v))
+					return
+				}
+				port = p
+			}
+			job, err := s.StartBackupJob(r.Context(), r.URL.Query().Get("host"), port)
+			if err != nil {
+				code := http.StatusInternalServerError
+				if errors.Is(err, ErrInvalidBackupSource) {
+					code = http.StatusBadRequest
+				} else if errors.Is(err, pg.ErrBackupInProgress) || errors.Is(err, pg.ErrNotStandby) {
+					code = http.StatusConflict
+				}
+				writeError(w, code, err)
+				return
+			}
+			writeJSON(w, http.StatusAccepted, job)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, nil)
+		}
+	}
+}
+
+func statusHandler(s *Sentinel) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.Status())
+	}
+}
+
+func resetHandler(s *Sentinel) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+		s.Reset()
+		writeJSON(w, http.StatusOK, s.Status())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.WriteHeader(code)
+	if err == nil {
+		w.Write([]byte(http.StatusText(code)))
+		return
+	}
+	w.Write([]byte(fmt.Sprintf("%s: %s", http.StatusText(code), err.Error())))
+}
@@ -0,0 +1,167 @@
+package sentinel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/pg"
+	"github.com/vontikov/pgcluster/internal/util"
+)
+
+var dictKeyHBA = []byte("hba")
+
+// memberAuthMethod is the authentication method of the members.
+const memberAuthMethod = "md5"
+
+// WithHBARules sets the pg_hba.conf rules in pg_hba.conf format separated by
+// new lines or semicolons. The rules stored in the storage take precedence.
+// pg_hba.conf is not managed if neither is set.
+func WithHBARules(v string) Option {
+	rules, err := pg.ParseHBARules(v)
+	util.PanicOnError(err)
+	return func(w *Sentinel) { w.hbaRules = rules }
+}
+
+// WithReplicationNetworks sets the comma separated addresses in pg_hba.conf
+// format, e.g. CIDR, host names or samenet, the members may replicate from
+// whether they are registered or not, e.g. a new node taking the initial
+// backup. Empty disables.
+func WithReplicationNetworks(v string) Option {
+	var nets []string
+	for _, n := range strings.Split(v, ",") {
+		if n = strings.TrimSpace(n); n == "" {
+			continue
+		}
+		r := pg.HBARule{Type: "host", Database: "replication", User: "all", Address: n, Method: memberAuthMethod}
+		util.PanicOnError(r.Validate())
+		nets = append(nets, n)
+	}
+	return func(w *Sentinel) { w.replicationNets = nets }
+}
+
+// WithReplicationUser sets the user the members replicate with.
+func WithReplicationUser(v string) Option {
+	return func(w *Sentinel) { w.replicationUser = v }
+}
+
+// HBARules returns the pg_hba.conf rules stored in the storage or nil.
+func (w *Sentinel) HBARules(ctx context.Context) ([]*pg.HBARule, error) {
+	payload, err := w.storage.DictionaryGet(ctx, dictKeyHBA)
+	if err != nil || payload == nil {
+		return nil, err
+	}
+	var r []*pg.HBARule
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetHBARules stores the pg_hba.conf rules to be applied on all the nodes. The
+// rules are removed if nil, and the nodes fall back to their own.
+func (w *Sentinel) SetHBARules(ctx context.Context, rules []*pg.HBARule) error {
+	if rules == nil {
+		w.logger.Warn("removing pg_hba.conf rules")
+		return w.storage.DictionaryRemove(ctx, dictKeyHBA)
+	}
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	payload, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	w.logger.Warn("updating pg_hba.conf rules", "rules", len(rules))
+	return w.storage.DictionaryPut(ctx, dictKeyHBA, payload)
+}
+
+// effectiveHBA returns the pg_hba.conf rules of the node or nil if pg_hba.conf
+// is not managed: the replication rules for the replication networks and the
+// members go first, then the stored rules or the node ones. The member
+// records expire, so the networks let the members not registered replicate.
+func (w *Sentinel) effectiveHBA(ctx context.Context) ([]*pg.HBARule, error) {
+	rules, err := w.HBARules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = w.hbaRules
+	}
+	if rules == nil {
+		return nil, nil
+	}
+
+	members, err := w.Members(ctx)
+	if err != nil {
+		return nil, err
+	}
+	addrs := append([]string{}, w.replicationNets...)
+	for _, m := range members {
+		addrs = append(addrs, w.memberAddresses(m.Host)...)
+	}
+	var r []*pg.HBARule
+	for _, addr := range addrs {
+		// pg_rewind connects to a database
+		for _, db := range []string{"replication", "all"} {
+			r = append(r, &pg.HBARule{
+				Type:     "host",
+				Database: db,
+				User:     w.replicationUser,
+				Address:  addr,
+				Method:   memberAuthMethod,
+			})
+		}
+	}
+	return append(r, rules...), nil
+}
+
+// memberAddresses returns the addresses of the host in CIDR notation, or the
+// host name if it is not resolved.
+func (w *Sentinel) memberAddresses(host string) []string {
+	ips, err := w.lookupIP(host)
+	if err != nil || len(ips) == 0 {
+		w.logger.Warn("member address is not resolved", "host", host, "message", err)
+		return []string{host}
+	}
+	r := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		r = append(r, fmt.Sprintf("%s/%d", ip, bits))
+	}
+	// the resolver order may change
+	sort.Strings(r)
+	return r
+}
+
+// applyHBA renders pg_hba.conf once the rules change.
+func (w *Sentinel) applyHBA(ctx context.Context) error {
+	rules, err := w.effectiveHBA(ctx)
+	if err != nil || rules == nil {
+		return err
+	}
+	content := pg.RenderHBA(rules)
+	if content == w.appliedHBA {
+		return nil
+	}
+
+	err = w.c.SetHBA(ctx, rules)
+	w.smu.Lock()
+	w.hbaError = ""
+	if err != nil {
+		w.hbaError = err.Error()
+	}
+	w.hbaApplied = time.Now()
+	w.smu.Unlock()
+	// not retried until the rules change, the previous file is restored
+	w.appliedHBA = content
+	return err
+}
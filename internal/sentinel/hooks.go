@@ -0,0 +1,43 @@
+package sentinel
+
+import (
+	"context"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/hook"
+)
+
+func (w *Sentinel) newEvent(t string) *hook.Event {
+	e := &hook.Event{
+		Type:      t,
+		Node:      w.hostname,
+		Role:      w.State().String(),
+		Term:      w.Term(),
+		Timestamp: time.Now().UTC(),
+	}
+	if w.State() == Master {
+		e.MasterHost = w.hostname
+		e.MasterPort = w.port
+	} else if w.masterInfo != nil {
+		e.MasterHost = w.masterInfo.Host
+		e.MasterPort = w.masterInfo.Port
+	}
+	return e
+}
+
+func (w *Sentinel) fire(t string) {
+	w.hooks.Fire(w.newEvent(t))
+}
+
+func (w *Sentinel) fireRoleChange(prev ClusterState) {
+	e := w.newEvent(hook.OnRoleChange)
+	e.PrevRole = prev.String()
+	w.hooks.Fire(e)
+}
+
+// runStopHook runs the on_stop action and waits for it to complete.
+func (w *Sentinel) runStopHook() {
+	if err := w.hooks.Run(context.Background(), w.newEvent(hook.OnStop)); err != nil {
+		w.logger.Error("hook error", "type", hook.OnStop, "message", err)
+	}
+}
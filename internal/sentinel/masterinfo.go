@@ -0,0 +1,107 @@
+package sentinel
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/app"
+	"github.com/vontikov/pgcluster/internal/pg"
+)
+
+// MasterInfoVersion is the version of the master info format.
+const MasterInfoVersion = 1
+
+var dictKeyMasterInfo = []byte("master-info")
+
+// hostinfo is the legacy gob encoded master info.
+type hostinfo struct {
+	Host string
+	Port int
+}
+
+// MasterInfo describes the master. It is stored as JSON so that it can be
+// read by tools other than the agent.
+type MasterInfo struct {
+	// Version is the format version, 0 for the legacy format.
+	Version      int       `json:"version"`
+	Host         string    `json:"host"`
+	Port         int       `json:"port"`
+	Timeline     int       `json:"timeline"`
+	LSN          pg.LSN    `json:"lsn"`
+	PromotedAt   time.Time `json:"promoted_at"`
+	Term         uint64    `json:"term"`
+	AgentVersion string    `json:"agent_version"`
+}
+
+func decodeMasterInfo(payload []byte) (*MasterInfo, error) {
+	var mi MasterInfo
+	if len(payload) > 0 && payload[0] == '{' {
+		if err := json.Unmarshal(payload, &mi); err != nil {
+			return nil, err
+		}
+		return &mi, nil
+	}
+
+	// written by an agent of the previous version during rolling upgrade
+	var hi hostinfo
+	if err := gob.NewDecoder(bytes.NewBuffer(payload)).Decode(&hi); err != nil {
+		return nil, err
+	}
+	mi.Host = hi.Host
+	mi.Port = hi.Port
+	return &mi, nil
+}
+
+// readMasterInfo returns the master info or nil if it is not available.
+func (w *Sentinel) readMasterInfo(ctx context.Context) (*MasterInfo, error) {
+	payload, err := w.storage.DictionaryGet(ctx, dictKeyMasterInfo)
+	if err != nil || payload == nil {
+		return nil, err
+	}
+	return decodeMasterInfo(payload)
+}
+
+// publishMasterInfo describes the instance as the master of the current term.
+func (w *Sentinel) publishMasterInfo(ctx context.Context) error {
+	tl, err := w.c.Timeline(ctx)
+	if err != nil {
+		return err
+	}
+	p, err := w.c.WalPosition(ctx)
+	if err != nil {
+		return err
+	}
+
+	mi := MasterInfo{
+		Version:      MasterInfoVersion,
+		Host:         w.hostname,
+		Port:         w.port,
+		Timeline:     tl,
+		LSN:          p.Current,
+		PromotedAt:   time.Now().UTC(),
+		Term:         w.Term(),
+		AgentVersion: app.Version,
+	}
+	payload, err := json.Marshal(&mi)
+	if err != nil {
+		return err
+	}
+	if err := w.storage.DictionaryPut(ctx, dictKeyMasterInfo, payload); err != nil {
+		return err
+	}
+	w.payload = payload
+	w.logger.Info("master info published", "term", mi.Term, "timeline", mi.Timeline, "lsn", mi.LSN)
+	return nil
+}
+
+// lastTerm returns the term of the current master info, 0 if not available.
+func (w *Sentinel) lastTerm(ctx context.Context) (uint64, error) {
+	mi, err := w.readMasterInfo(ctx)
+	if err != nil || mi == nil {
+		return 0, err
+	}
+	return mi.Term, nil
+}
@@ -0,0 +1,178 @@
+package sentinel
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/app"
+	"github.com/vontikov/pgcluster/internal/pg"
+)
+
+var dictKeyMemberPrefix = []byte("members/")
+
+// Supported member tags.
+const (
+	// TagNoFailover prevents the member from being promoted.
+	TagNoFailover = "nofailover"
+	// TagFailoverPriority is the member priority to be promoted, higher
+	// values are preferred.
+	TagFailoverPriority = "failover_priority"
+	// TagCloneFrom makes the member the preferred source for backups.
+	TagCloneFrom = "clonefrom"
+)
+
+// Possible member states.
+const (
+	MemberRunning = "running"
+	MemberDown    = "down"
+)
+
+// Member describes a cluster member. Members register themselves on every
+// check; the registration expires within the storage TTL unless renewed.
+type Member struct {
+	Name      string            `json:"name"`
+	Host      string            `json:"host"`
+	Port      int               `json:"port"`
+	Role      string            `json:"role"`
+	State     string            `json:"state"`
+	LSN       pg.LSN            `json:"lsn"`
+	Position  pg.WalPosition    `json:"position"`
+	Lag       uint64            `json:"lag"`
+	Term      uint64            `json:"term"`
+	Paused    bool              `json:"paused"`
+	Unhealthy bool              `json:"unhealthy,omitempty"`
+	APIURL    string            `json:"api_url,omitempty"`
+	Version   string            `json:"version"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// standby returns true if the member is a running standby.
+func (m *Member) standby() bool {
+	return m.Role == Replica.String() && m.State == MemberRunning && m.Position.Current == pg.InvalidLSN
+}
+
+func (m *Member) boolTag(k string) bool {
+	r, _ := strconv.ParseBool(m.Tags[k])
+	return r
+}
+
+func (m *Member) noFailover() bool {
+	return m.boolTag(TagNoFailover)
+}
+
+func (m *Member) cloneFrom() bool {
+	return m.boolTag(TagCloneFrom)
+}
+
+func (m *Member) failoverPriority() int {
+	r, _ := strconv.Atoi(m.Tags[TagFailoverPriority])
+	return r
+}
+
+func memberKey(name string) []byte {
+	return append(append([]byte{}, dictKeyMemberPrefix...), name...)
+}
+
+// parseTags parses the comma separated key=value pairs. A key without value
+// is set to true.
+func parseTags(v string) map[string]string {
+	r := make(map[string]string)
+	for _, t := range strings.Split(v, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		kv := strings.SplitN(t, "=", 2)
+		if len(kv) == 1 {
+			r[kv[0]] = "true"
+			continue
+		}
+		r[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return r
+}
+
+// register publishes the instance member record according to the last probe.
+// The record is returned even if it failed to be published.
+func (w *Sentinel) register(ctx context.Context) (*Member, error) {
+	m := &Member{
+		Name:      w.hostname,
+		Host:      w.hostname,
+		Port:      w.port,
+		Role:      w.state.String(),
+		State:     MemberDown,
+		APIURL:    w.apiURL,
+		Version:   app.Version,
+		Tags:      w.tags,
+		Term:      w.Term(),
+		Paused:    w.Paused(),
+		Unhealthy: w.Unhealthy(),
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	if w.alive {
+		p, err := w.c.WalPosition(ctx)
+		if err != nil {
+			return nil, err
+		}
+		m.State = MemberRunning
+		m.Position = *p
+		m.LSN = p.Current
+		if p.Current == pg.InvalidLSN {
+			m.LSN = p.Max()
+		}
+	}
+
+	if m.standby() && w.masterInfo != nil {
+		master, err := w.getMember(ctx, w.masterInfo.Host)
+		if err != nil {
+			return m, err
+		}
+		if master != nil {
+			m.Lag = master.LSN.Distance(m.Position.Replayed)
+		}
+	}
+
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return m, err
+	}
+	return m, w.storage.DictionaryPutTTL(ctx, memberKey(m.Name), payload)
+}
+
+// getMember returns the member registered under the name or nil.
+func (w *Sentinel) getMember(ctx context.Context, name string) (*Member, error) {
+	payload, err := w.storage.DictionaryGet(ctx, memberKey(name))
+	if err != nil || payload == nil {
+		return nil, err
+	}
+	var m Member
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Members returns the registered cluster members sorted by name.
+func (w *Sentinel) Members(ctx context.Context) ([]*Member, error) {
+	kvs, err := w.storage.DictionaryRange(ctx, dictKeyMemberPrefix)
+	if err != nil {
+		return nil, err
+	}
+	r := make([]*Member, 0, len(kvs))
+	for k, v := range kvs {
+		var m Member
+		if err := json.Unmarshal(v, &m); err != nil {
+			w.logger.Warn("malformed member", "key", k, "message", err)
+			continue
+		}
+		r = append(r, &m)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+	return r, nil
+}
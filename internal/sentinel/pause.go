@@ -0,0 +1,62 @@
+package sentinel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var dictKeyPause = []byte("pause")
+
+// ErrPaused is returned when an operation is not allowed while the cluster is
+// paused.
+var ErrPaused = errors.New("cluster is paused")
+
+// Pause pauses the automatic failover on all the nodes. While paused the nodes
+// keep observing and reporting the cluster state, but do not promote, follow
+// or release the master mutex.
+func (w *Sentinel) Pause(ctx context.Context) error {
+	w.logger.Warn("pausing the cluster")
+	v := []byte(time.Now().UTC().Format(time.RFC3339))
+	if err := w.storage.DictionaryPut(ctx, dictKeyPause, v); err != nil {
+		return err
+	}
+	w.setPaused(true)
+	return nil
+}
+
+// Resume resumes the automatic failover on all the nodes.
+func (w *Sentinel) Resume(ctx context.Context) error {
+	w.logger.Warn("resuming the cluster")
+	if err := w.storage.DictionaryRemove(ctx, dictKeyPause); err != nil {
+		return err
+	}
+	w.setPaused(false)
+	return nil
+}
+
+// Paused returns true if the node has observed the cluster paused.
+func (w *Sentinel) Paused() bool {
+	return atomic.LoadInt32(&w.paused) == 1
+}
+
+func (w *Sentinel) setPaused(v bool) {
+	var i int32
+	if v {
+		i = 1
+	}
+	if atomic.SwapInt32(&w.paused, i) != i {
+		w.logger.Warn("cluster pause changed", "paused", v)
+	}
+}
+
+// observePause reads the cluster pause flag.
+func (w *Sentinel) observePause(ctx context.Context) error {
+	v, err := w.storage.DictionaryGet(ctx, dictKeyPause)
+	if err != nil {
+		return err
+	}
+	w.setPaused(v != nil)
+	return nil
+}
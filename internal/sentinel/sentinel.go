@@ -1,17 +1,20 @@
 package sentinel
 
 import (
-	"bytes"
 	"context"
-	"encoding/gob"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/vontikov/pgcluster/internal/hook"
 	"github.com/vontikov/pgcluster/internal/logging"
 	"github.com/vontikov/pgcluster/internal/pg"
 	"github.com/vontikov/pgcluster/internal/storage"
+	"github.com/vontikov/pgcluster/internal/util"
 )
 
 const (
@@ -26,14 +29,23 @@ const (
 	DefaultPgAwaitTimeout = 60 * time.Second
 
 	DefaultPgPollDelay = 1 * time.Second
-)
 
-var dictKeyMasterInfo = []byte("master-info")
+	// DefaultSwitchoverTimeout is the default timeout for a planned
+	// switchover to complete.
+	DefaultSwitchoverTimeout = 60 * time.Second
 
-type hostinfo struct {
-	Host string
-	Port int
-}
+	// DefaultReplicationUser is the default user the members replicate with.
+	DefaultReplicationUser = "replicator"
+
+	// DefaultReplicationNetworks are the default addresses the members may
+	// replicate from in addition to the registered ones: the subnets the
+	// node is connected to.
+	DefaultReplicationNetworks = "samenet"
+
+	// DefaultMaxLag is the default maximum number of WAL bytes a replica may
+	// be behind the most advanced one to compete for the master mutex.
+	DefaultMaxLag = 0
+)
 
 // ClusterState enumerates Cluster state.
 type ClusterState int32
@@ -45,25 +57,93 @@ const (
 	Replica
 )
 
+func (s ClusterState) String() string {
+	switch s {
+	case Detached:
+		return "detached"
+	case Master:
+		return "master"
+	case Replica:
+		return "replica"
+	default:
+		return "unknown"
+	}
+}
+
 // Sentinel watches the Cluster state.
 type Sentinel struct {
+	term uint64 // accessed atomically, keep 64-bit aligned
+
 	c        pg.Cluster
 	storage  storage.Storage
 	hostname string
 	port     int
 	interval time.Duration
 	logger   logging.Logger
+	hooks    *hook.Hooks
 	errChan  chan error
+	stopped  chan struct{}
+
+	systemID          uint64
+	apiURL            string
+	tags              map[string]string
+	maxLag            uint64
+	switchoverTimeout time.Duration
+
+	unhealthyAfter int
+	stopAfter      int
+	exitAfter      int
 
-	done int32
+	failureThreshold int
+	probeTimeout     time.Duration
+	minDownTime      time.Duration
 
-	mu                  sync.RWMutex // protects following fields
-	state               ClusterState
-	masterInfo          *hostinfo
-	payload             []byte
+	reinitAfter int
+
+	slotDropAfter time.Duration
+
+	hbaRules        []*pg.HBARule
+	replicationUser string
+	replicationNets []string
+	lookupIP        func(string) ([]net.IP, error)
+
+	done      int32
+	paused    int32
+	unhealthy int32
+
+	mu         sync.RWMutex // protects following fields
+	state      ClusterState
+	masterInfo *MasterInfo
+	payload    []byte
+	alive      bool
+	slots      map[string]time.Time // the time the members of the managed slots have gone
+
+	configFailed map[string]string // the parameter values failed to be applied
+	appliedHBA   string
+
+	smu                 sync.Mutex // protects following fields
+	master              *MasterInfo
 	lastCheck           time.Time
+	lastError           string
+	lastErrorAt         time.Time
 	counterCheckSuccess int
 	counterCheckErrors  int
+	consecutiveErrors   int
+	escalationLevel     int
+	escalations         map[string]int
+	probeFailures       int
+	downSince           time.Time
+	masterFailures      int
+	masterDownSince     time.Time
+	detachedReason      string
+	detachedSince       time.Time
+	recoveryAttempts    int
+	nextRecovery        time.Time
+	configApplied       time.Time
+	configError         string
+	pendingRestart      []string
+	hbaApplied          time.Time
+	hbaError            string
 }
 
 // Option defines configuration option.
@@ -85,6 +165,36 @@ func WithInterval(v string) Option {
 	}
 }
 
+// WithHooks sets the actions run on the Sentinel events.
+func WithHooks(v *hook.Hooks) Option {
+	return func(w *Sentinel) { w.hooks = v }
+}
+
+// WithAPIURL sets the management API URL the instance is registered with.
+func WithAPIURL(v string) Option {
+	return func(w *Sentinel) { w.apiURL = v }
+}
+
+// WithTags sets the instance tags as comma separated key=value pairs.
+func WithTags(v string) Option {
+	return func(w *Sentinel) { w.tags = parseTags(v) }
+}
+
+// WithMaxLag sets the maximum number of WAL bytes a replica may be behind the
+// most advanced one to compete for the master mutex.
+func WithMaxLag(v string) Option {
+	r, err := strconv.ParseUint(v, 10, 64)
+	util.PanicOnError(err)
+	return func(w *Sentinel) { w.maxLag = r }
+}
+
+// WithSwitchoverTimeout sets the timeout for a planned switchover to complete.
+func WithSwitchoverTimeout(v string) Option {
+	d, err := time.ParseDuration(v)
+	util.PanicOnError(err)
+	return func(w *Sentinel) { w.switchoverTimeout = d }
+}
+
 // New creates new instance.
 func New(c pg.Cluster, s storage.Storage, selfHost string, selfPgPort int, opts ...Option) *Sentinel {
 	d, _ := time.ParseDuration(DefaultInterval)
@@ -97,8 +207,30 @@ func New(c pg.Cluster, s storage.Storage, selfHost string, selfPgPort int, opts
 
 		logger:   logging.NewLogger(DefaultLoggerName),
 		interval: d,
+		maxLag:   DefaultMaxLag,
+
+		switchoverTimeout: DefaultSwitchoverTimeout,
+
+		failureThreshold: DefaultFailureThreshold,
+		probeTimeout:     DefaultProbeTimeout,
+		minDownTime:      DefaultMinDownTime,
+
+		reinitAfter: DefaultReinitAfter,
+
+		slotDropAfter: DefaultSlotDropAfter,
+		slots:         make(map[string]time.Time),
 
+		configFailed: make(map[string]string),
+
+		replicationUser: DefaultReplicationUser,
+		replicationNets: []string{DefaultReplicationNetworks},
+		lookupIP:        net.LookupIP,
+
+		hooks:   hook.New(),
 		errChan: make(chan error, 1),
+		stopped: make(chan struct{}),
+
+		escalations: make(map[string]int),
 	}
 	for _, o := range opts {
 		o(w)
@@ -108,14 +240,11 @@ func New(c pg.Cluster, s storage.Storage, selfHost string, selfPgPort int, opts
 
 // Prepare prepares the instance.
 func (w *Sentinel) Prepare(ctx context.Context) error {
-	var buf bytes.Buffer
-	err := gob.NewEncoder(&buf).Encode(&hostinfo{Host: w.hostname, Port: w.port})
-	if err != nil {
+	if err := w.verifySystemID(ctx); err != nil {
 		return err
 	}
-	w.payload = buf.Bytes()
 
-	inRecovery, err := w.c.InRecovery()
+	inRecovery, err := w.c.InRecovery(ctx)
 	if err != nil {
 		return err
 	}
@@ -130,6 +259,7 @@ func (w *Sentinel) Prepare(ctx context.Context) error {
 		return err
 	}
 
+	go w.hooks.Start(ctx)
 	go func() {
 		<-ctx.Done()
 		close(w.errChan)
@@ -148,10 +278,15 @@ func (w *Sentinel) prepareMaster(ctx context.Context) error {
 	// confirm master status
 	if locked {
 		w.mu.Lock()
-		w.state = Master
-		w.mu.Unlock()
-		err := w.storage.DictionaryPut(ctx, dictKeyMasterInfo, w.payload)
-		return err
+		defer w.mu.Unlock()
+		w.setState(Master)
+		if err := w.bootstrapSystemID(ctx); err != nil {
+			return err
+		}
+		if _, err := w.bumpTerm(ctx); err != nil {
+			return err
+		}
+		return w.publishMasterInfo(ctx)
 	}
 
 	// follow new master
@@ -159,18 +294,20 @@ func (w *Sentinel) prepareMaster(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	if err := w.c.Stop(); err != nil {
+	if err := w.c.Stop(ctx); err != nil {
 		return err
 	}
-	if err := w.c.Backup(hi.Host, hi.Port); err != nil {
+	if err := w.resync(ctx, hi); err != nil {
 		return err
 	}
-	if err := w.c.Start(); err != nil {
+	if err := w.c.Start(ctx); err != nil {
 		return err
 	}
 	w.mu.Lock()
-	w.state = Replica
+	w.setState(Replica)
+	w.masterInfo = hi
 	w.mu.Unlock()
+	w.fire(hook.OnFollow)
 	return nil
 }
 
@@ -182,15 +319,19 @@ func (w *Sentinel) awaitMaster(ctx context.Context) error {
 		case <-ctx.Done():
 			return fmt.Errorf("master is not reachable within: %v", DefaultPgAwaitTimeout)
 		default:
-			masterInfo, err := w.c.MasterInfo()
+			masterInfo, err := w.c.MasterInfo(ctx)
 			if err != nil {
 				return err
 			}
 			if masterInfo != nil {
 				w.mu.Lock()
-				w.state = Replica
-				w.masterInfo = &hostinfo{Host: masterInfo.Host, Port: masterInfo.Port}
+				w.setState(Replica)
+				w.masterInfo = &MasterInfo{Host: masterInfo.Host, Port: masterInfo.Port}
 				w.mu.Unlock()
+				// the replica may have been set up without the slot
+				if err := w.c.SetPrimarySlotName(ctx); err != nil {
+					w.logger.Warn("failed to set the primary slot name", "message", err)
+				}
 				return nil
 			}
 			w.logger.Trace("master is not reachable yet")
@@ -204,6 +345,12 @@ func (w *Sentinel) State() ClusterState {
 	return ClusterState(atomic.LoadInt32((*int32)(&w.state)))
 }
 
+// setState sets the state. It must be called under w.mu, the state is read
+// by State() without it.
+func (w *Sentinel) setState(v ClusterState) {
+	atomic.StoreInt32((*int32)(&w.state), int32(v))
+}
+
 // Err returns the channel used to send errors while watching the Cluster state.
 // The channel is closed when Wathchers stops.
 func (w *Sentinel) Err() <-chan error {
@@ -212,19 +359,35 @@ func (w *Sentinel) Err() <-chan error {
 
 // Reset resets the instance: counters, etc.
 func (w *Sentinel) Reset() {
-	w.mu.Lock()
-	defer w.mu.Unlock()
+	w.smu.Lock()
+	defer w.smu.Unlock()
 	w.counterCheckSuccess = 0
 	w.counterCheckErrors = 0
+	w.consecutiveErrors = 0
+	w.escalationLevel = 0
+	w.escalations = make(map[string]int)
+	w.setUnhealthy(false)
+	w.lastError = ""
+	w.lastErrorAt = time.Time{}
+}
+
+// Stopped returns the channel which is closed when the watching cycle is
+// stopped.
+func (w *Sentinel) Stopped() <-chan struct{} {
+	return w.stopped
 }
 
 // Start runs the watching cycle.
 func (w *Sentinel) Start(ctx context.Context) {
 	t := time.NewTicker(w.interval)
 	defer t.Stop()
+	defer close(w.stopped)
+
+	w.fire(hook.OnStart)
 	for {
 		select {
 		case <-ctx.Done():
+			w.runStopHook()
 			return
 		case <-t.C:
 			w.check(ctx)
@@ -243,69 +406,118 @@ func (w *Sentinel) check(ctx context.Context) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	prev := w.state
 	var err error
 	defer func() {
+		if w.state != prev {
+			w.fireRoleChange(prev)
+		}
+		// counted before the escalation reads the consecutive errors
+		w.recordCheck(err)
 		if err != nil {
-			w.counterCheckErrors++
 			w.setErr(err)
-		} else {
-			w.counterCheckSuccess++
 		}
-		w.lastCheck = time.Now()
 	}()
 
+	if perr := w.observePause(ctx); perr != nil {
+		w.logger.Warn("pause check error", "message", perr)
+	}
+
+	if w.backupRunning(ctx) {
+		// the job stops and starts the instance
+		w.logger.Info("backup job is running")
+		w.alive = false
+		if _, rerr := w.register(ctx); rerr != nil {
+			w.logger.Warn("registration error", "message", rerr)
+		}
+		return
+	}
+
+	w.probe(ctx)
+	self, rerr := w.register(ctx)
+	if rerr != nil {
+		w.logger.Warn("registration error", "message", rerr)
+	}
+	if w.alive {
+		if cerr := w.applyConfig(ctx); cerr != nil {
+			w.logger.Warn("config error", "message", cerr)
+		}
+		if herr := w.applyHBA(ctx); herr != nil {
+			w.logger.Warn("pg_hba.conf error", "message", herr)
+		}
+	}
+
 	switch w.state {
 	case Master:
 		err = w.checkMaster(ctx)
 	case Replica:
-		err = w.checkReplica(ctx)
+		err = w.checkReplica(ctx, self)
 	default:
 		err = w.checkDetached(ctx)
 	}
 }
 
 func (w *Sentinel) checkMaster(ctx context.Context) (err error) {
-	r, err := w.c.Alive()
-	if err != nil || !r {
+	if err = w.checkTerm(ctx); err != nil {
+		w.logger.Error("term check failed", "message", err)
+		if errors.Is(err, ErrStaleTerm) {
+			w.stepDown(ctx)
+		}
+		return
+	}
+
+	if !w.alive {
+		if !w.down() {
+			w.logger.Warn("master probe failed")
+			return
+		}
+		if w.Paused() {
+			w.logger.Warn("master is down, cluster is paused")
+			return
+		}
 		w.logger.Warn("master is down")
 		if err = w.storage.MutexUnlock(ctx); err != nil {
-			w.state = Detached
+			w.detach("failed to release the master mutex", err)
 		}
 		return
 	}
 	w.logger.Trace("master is up")
-	return
+	if err := w.syncSlots(ctx); err != nil {
+		w.logger.Warn("replication slots error", "message", err)
+	}
+	if w.Paused() {
+		return
+	}
+	return w.switchover(ctx)
 }
 
-func (w *Sentinel) checkReplica(ctx context.Context) error {
+func (w *Sentinel) checkReplica(ctx context.Context, self *Member) error {
 	w.logger.Trace("checking replica")
-	r, err := w.c.Alive()
-	if err != nil || !r {
+	if self == nil || self.State != MemberRunning {
+		if !w.down() {
+			w.logger.Warn("replica probe failed")
+			return nil
+		}
 		w.logger.Warn("replica is down")
+		if w.Paused() {
+			return nil
+		}
+		return w.follow(ctx)
 	}
 	w.logger.Trace("replica OK")
+	if w.Paused() {
+		return nil
+	}
 
-	locked, err := w.storage.MutexTryLock(ctx)
+	candidate, err := w.promotionCandidate(ctx, self)
 	if err != nil {
-		w.logger.Warn("mutex eror", "message", err)
+		w.logger.Warn("WAL position error", "message", err)
 		return err
 	}
-
-	if locked {
-		return w.promote(ctx)
-	}
-	return w.follow(ctx)
-}
-
-func (w *Sentinel) checkDetached(ctx context.Context) (err error) {
-	r, err := w.c.Alive()
-	if err != nil || !r {
-		w.logger.Warn("instance is down")
-		return
+	if !candidate {
+		return w.follow(ctx)
 	}
 
-	w.logger.Trace("instance is up")
-
 	locked, err := w.storage.MutexTryLock(ctx)
 	if err != nil {
 		w.logger.Warn("mutex eror", "message", err)
@@ -313,26 +525,25 @@ func (w *Sentinel) checkDetached(ctx context.Context) (err error) {
 	}
 
 	if locked {
-		return fmt.Errorf("inconsistent state")
-	}
-
-	if err = w.follow(ctx); err != nil {
-		return
+		return w.promote(ctx)
 	}
-
-	w.state = Replica
-	return
+	return w.follow(ctx)
 }
 
 func (w *Sentinel) promote(ctx context.Context) error {
 	w.logger.Warn("promoting")
 
+	if _, err := w.bumpTerm(ctx); err != nil {
+		_ = w.storage.MutexUnlock(ctx)
+		return err
+	}
+
 	// reset current master
 	if err := w.storage.DictionaryRemove(ctx, dictKeyMasterInfo); err != nil {
 		return err
 	}
 
-	if err := w.c.Promote(); err != nil {
+	if err := w.c.Promote(ctx); err != nil {
 		w.logger.Warn("failed to promote", "message", err)
 		_ = w.storage.MutexUnlock(ctx)
 		return err
@@ -348,7 +559,7 @@ loop:
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			if r, err := w.c.InRecovery(); err == nil && !r {
+			if r, err := w.c.InRecovery(ctx); err == nil && !r {
 				time.Sleep(DefaultPgPollDelay)
 				break loop
 			}
@@ -356,10 +567,16 @@ loop:
 		}
 	}
 
-	w.state = Master
-	if err := w.storage.DictionaryPut(ctx, dictKeyMasterInfo, w.payload); err != nil {
+	w.setState(Master)
+	if err := w.publishMasterInfo(ctx); err != nil {
 		return err
 	}
+	// slots are not replicated, recreate them for the members to follow
+	if err := w.syncSlots(ctx); err != nil {
+		w.logger.Warn("replication slots error", "message", err)
+	}
+	w.removeSwitchover(ctx)
+	w.fire(hook.OnPromote)
 	return nil
 }
 
@@ -373,29 +590,55 @@ func (w *Sentinel) follow(ctx context.Context) error {
 		w.logger.Trace("actual master", "host", actualMaster.Host, "port", actualMaster.Port)
 	}
 
+	w.setTerm(actualMaster.Term)
 	if w.masterInfo != nil && w.masterInfo.Host == actualMaster.Host && w.masterInfo.Port == actualMaster.Port {
 		return nil
 	}
 
 	w.logger.Warn("master changed to", "host", actualMaster.Host, "port", actualMaster.Port)
-	if err := w.c.Stop(); err != nil {
-		w.state = Detached
+	if err := w.stop(ctx); err != nil {
+		w.detach("failed to stop", err)
 		return err
 	}
 
-	if err := w.c.Backup(actualMaster.Host, actualMaster.Port); err != nil {
-		w.state = Detached
+	if err := w.resync(ctx, actualMaster); err != nil {
+		w.detach("failed to resync", err)
 		return err
 	}
-	if err := w.c.Start(); err != nil {
-		w.state = Detached
+	if err := w.c.Start(ctx); err != nil {
+		w.detach("failed to start", err)
 		return err
 	}
-	w.masterInfo = &hostinfo{Host: actualMaster.Host, Port: actualMaster.Port}
+	w.masterInfo = actualMaster
+	w.fire(hook.OnFollow)
 	return nil
 }
 
-func (w *Sentinel) getMaster(ctx context.Context) (*hostinfo, error) {
+// resync synchronizes the stopped instance with the master. It tries to rewind
+// the instance and falls back to the full backup, preferably from a replica
+// tagged as the clone source.
+func (w *Sentinel) resync(ctx context.Context, master *MasterInfo) error {
+	err := w.c.Rewind(ctx, master.Host, master.Port)
+	if err == nil {
+		return nil
+	}
+	w.logger.Warn("rewind failed, backing up", "message", err)
+
+	src, err := w.cloneSource(ctx, master)
+	if err != nil {
+		w.logger.Warn("clone source error", "message", err)
+	}
+	if src != nil {
+		w.logger.Info("cloning from", "host", src.Host, "port", src.Port)
+		if err = w.c.Backup(ctx, src.Host, src.Port); err == nil {
+			return w.c.SetPrimary(ctx, master.Host, master.Port)
+		}
+		w.logger.Warn("clone failed, backing up from the master", "message", err)
+	}
+	return w.c.Backup(ctx, master.Host, master.Port)
+}
+
+func (w *Sentinel) getMaster(ctx context.Context) (*MasterInfo, error) {
 	ctx, cancel := context.WithTimeout(ctx, DefaultPgAwaitTimeout)
 	defer cancel()
 
@@ -405,17 +648,13 @@ func (w *Sentinel) getMaster(ctx context.Context) (*hostinfo, error) {
 		case <-ctx.Done():
 			return nil, fmt.Errorf("master info is not available within: %v", DefaultPgAwaitTimeout)
 		default:
-			payload, err := w.storage.DictionaryGet(ctx, dictKeyMasterInfo)
+			mi, err := w.readMasterInfo(ctx)
 			if err != nil {
 				return nil, err
 			}
-			if payload != nil {
-				var hi hostinfo
-				if err := gob.NewDecoder(bytes.NewBuffer(payload)).Decode(&hi); err != nil {
-					return nil, err
-				}
-				w.logger.Trace("received master info", "data", hi)
-				return &hi, nil
+			if mi != nil {
+				w.logger.Trace("received master info", "data", mi)
+				return mi, nil
 			}
 			w.logger.Trace("master info is not available yet")
 			time.Sleep(DefaultPgPollDelay)
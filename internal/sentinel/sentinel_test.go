@@ -4,7 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
 	"testing"
+	"time"
 
 	gm "github.com/golang/mock/gomock"
 
@@ -15,12 +20,16 @@ import (
 	mock_storage "github.com/vontikov/pgcluster/mocks/storage"
 )
 
+const testSystemID = 6960000000000000001
+
 func TestPrepareMaster(t *testing.T) {
 	const (
 		selfHost    = "localhost"
 		selfPort    = pg.DefaultPort
 		inRecovery  = false
 		mutexLocked = true
+		timeline    = 2
+		lsn         = pg.LSN(0x3000060)
 	)
 
 	assert := assert.New(t)
@@ -31,29 +40,65 @@ func TestPrepareMaster(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	var payload bytes.Buffer
-	err := gob.NewEncoder(&payload).Encode(&hostinfo{selfHost, selfPort})
-	assert.Nil(err)
+	var payload []byte
 
 	c := mock_pg.NewMockCluster(ctrl)
 	s := mock_storage.NewMockStorage(ctrl)
 
-	c.EXPECT().InRecovery().
+	c.EXPECT().ControlData(gm.Any()).
+		Return(&pg.ControlData{SystemIdentifier: testSystemID}, nil).
+		Times(1)
+	s.EXPECT().DictionaryGet(ctx, dictKeySystemID).
+		Return(nil, nil).
+		Times(2)
+	s.EXPECT().DictionaryPut(ctx, dictKeySystemID, []byte(strconv.FormatUint(testSystemID, 10))).
+		Return(nil).
+		Times(1)
+
+	c.EXPECT().InRecovery(gm.Any()).
 		Return(inRecovery, nil).
 		Times(1)
 	s.EXPECT().MutexTryLock(ctx).
 		Return(mutexLocked, nil).
 		Times(1)
-	s.EXPECT().DictionaryPut(ctx, dictKeyMasterInfo, payload.Bytes()).
+	s.EXPECT().DictionaryGet(ctx, dictKeyTerm).
+		Return(nil, nil).
+		Times(1)
+	s.EXPECT().DictionaryGet(ctx, dictKeyMasterInfo).
+		Return(nil, nil).
+		Times(1)
+	s.EXPECT().DictionaryPut(ctx, dictKeyTerm, []byte("1")).
 		Return(nil).
 		Times(1)
+	c.EXPECT().Timeline(gm.Any()).
+		Return(timeline, nil).
+		Times(1)
+	c.EXPECT().WalPosition(gm.Any()).
+		Return(&pg.WalPosition{Current: lsn}, nil).
+		Times(1)
+	s.EXPECT().DictionaryPut(ctx, dictKeyMasterInfo, gm.Any()).
+		DoAndReturn(func(_ context.Context, _, v []byte) error {
+			payload = v
+			return nil
+		}).
+		Times(1)
 
 	w := New(c, s, selfHost, selfPort)
 	assert.NotNil(w)
 
-	err = w.Prepare(ctx)
+	err := w.Prepare(ctx)
 	assert.Nil(err)
 	assert.Equal(Master, w.State())
+
+	mi, err := decodeMasterInfo(payload)
+	assert.Nil(err)
+	assert.Equal(MasterInfoVersion, mi.Version)
+	assert.Equal(selfHost, mi.Host)
+	assert.Equal(selfPort, mi.Port)
+	assert.Equal(timeline, mi.Timeline)
+	assert.Equal(lsn, mi.LSN)
+	assert.Equal(uint64(1), mi.Term)
+	assert.Equal(uint64(1), w.Term())
 }
 
 func TestPrepareReplica(t *testing.T) {
@@ -78,13 +123,24 @@ func TestPrepareReplica(t *testing.T) {
 	c := mock_pg.NewMockCluster(ctrl)
 	s := mock_storage.NewMockStorage(ctrl)
 
-	c.EXPECT().InRecovery().
+	c.EXPECT().ControlData(gm.Any()).
+		Return(&pg.ControlData{SystemIdentifier: testSystemID}, nil).
+		Times(1)
+	s.EXPECT().DictionaryGet(ctx, dictKeySystemID).
+		Return([]byte(strconv.FormatUint(testSystemID, 10)), nil).
+		Times(1)
+
+	c.EXPECT().InRecovery(gm.Any()).
 		Return(inRecovery, nil).
 		Times(1)
 
-	c.EXPECT().MasterInfo().
+	c.EXPECT().MasterInfo(gm.Any()).
 		Return(&pg.ConnectionInfo{}, nil).
 		Times(1)
+	// the replica set up before the slots streams from its slot
+	c.EXPECT().SetPrimarySlotName(gm.Any()).
+		Return(nil).
+		Times(1)
 
 	w := New(c, s, selfHost, selfPort)
 	assert.NotNil(w)
@@ -119,7 +175,322 @@ func TestPrepareSecondMaster(t *testing.T) {
 	c := mock_pg.NewMockCluster(ctrl)
 	s := mock_storage.NewMockStorage(ctrl)
 
-	c.EXPECT().InRecovery().
+	c.EXPECT().ControlData(gm.Any()).
+		Return(&pg.ControlData{SystemIdentifier: testSystemID}, nil).
+		Times(1)
+	s.EXPECT().DictionaryGet(ctx, dictKeySystemID).
+		Return([]byte(strconv.FormatUint(testSystemID, 10)), nil).
+		Times(1)
+
+	c.EXPECT().InRecovery(gm.Any()).
+		Return(inRecovery, nil).
+		Times(1)
+	s.EXPECT().MutexTryLock(ctx).
+		Return(mutexLocked, nil).
+		Times(1)
+	s.EXPECT().DictionaryGet(gm.Any(), dictKeyMasterInfo).
+		Return(payload.Bytes(), nil).
+		Times(1)
+
+	c.EXPECT().Stop(gm.Any()).
+		Return(nil).
+		Times(1)
+	c.EXPECT().Rewind(gm.Any(), otherHost, otherPort).
+		Return(errors.New("rewind error")).
+		Times(1)
+	s.EXPECT().DictionaryRange(gm.Any(), dictKeyMemberPrefix).
+		Return(nil, nil).
+		Times(1)
+	c.EXPECT().Backup(gm.Any(), otherHost, otherPort).
+		Return(nil).
+		Times(1)
+	c.EXPECT().Start(gm.Any()).
+		Return(nil).
+		Times(1)
+
+	w := New(c, s, selfHost, selfPort)
+	assert.NotNil(w)
+
+	err = w.Prepare(ctx)
+	assert.Nil(err)
+	assert.Equal(Replica, w.State())
+}
+
+func TestIsFailoverCandidate(t *testing.T) {
+	assert := assert.New(t)
+
+	others := []candidate{{0x3000000, 0}, {0x3000100, 0}, {0x2FFFF00, 0}}
+
+	assert.True(isFailoverCandidate(candidate{0x3000100, 0}, others, 0))
+	assert.True(isFailoverCandidate(candidate{0x3000200, 0}, others, 0))
+	assert.False(isFailoverCandidate(candidate{0x3000000, 0}, others, 0))
+	assert.True(isFailoverCandidate(candidate{0x3000000, 0}, others, 0x100))
+	assert.False(isFailoverCandidate(candidate{0x2FFFF00, 0}, others, 0x100))
+	assert.True(isFailoverCandidate(candidate{0x1000, 0}, nil, 0))
+
+	// priority
+	others = []candidate{{0x3000000, 10}, {0x3000100, 0}}
+
+	assert.False(isFailoverCandidate(candidate{0x3000100, 0}, others, 0x100))
+	assert.True(isFailoverCandidate(candidate{0x3000100, 0}, others, 0))
+	assert.True(isFailoverCandidate(candidate{0x3000000, 10}, others, 0x100))
+	assert.True(isFailoverCandidate(candidate{0x3000100, 20}, others, 0x100))
+}
+
+func TestSwitchover(t *testing.T) {
+	const (
+		selfHost   = "localhost"
+		selfPort   = pg.DefaultPort
+		masterHost = "master"
+		candidate  = "replica"
+	)
+
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var master bytes.Buffer
+	err := gob.NewEncoder(&master).Encode(&hostinfo{masterHost, selfPort})
+	assert.Nil(err)
+
+	member, err := json.Marshal(&Member{
+		Name:  candidate,
+		Role:  Replica.String(),
+		State: MemberRunning,
+	})
+	assert.Nil(err)
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	s.EXPECT().DictionaryGet(ctx, dictKeySwitchover).
+		Return(nil, nil).
+		Times(3)
+	s.EXPECT().DictionaryGet(ctx, dictKeyMasterInfo).
+		Return(master.Bytes(), nil).
+		Times(3)
+	s.EXPECT().DictionaryGet(ctx, memberKey(candidate)).
+		Return(member, nil).
+		Times(1)
+	s.EXPECT().DictionaryGet(ctx, memberKey("unknown")).
+		Return(nil, nil).
+		Times(1)
+	s.EXPECT().DictionaryPut(ctx, dictKeySwitchover, gm.Any()).
+		DoAndReturn(func(_ context.Context, _, v []byte) error {
+			// readable by the external tools
+			var si SwitchoverInfo
+			assert.Nil(json.Unmarshal(v, &si))
+			assert.Equal(candidate, si.Candidate)
+			return nil
+		}).
+		Times(1)
+
+	w := New(c, s, selfHost, selfPort)
+
+	_, err = w.Switchover(ctx, "")
+	assert.ErrorIs(err, ErrNoCandidate)
+
+	_, err = w.Switchover(ctx, masterHost)
+	assert.ErrorIs(err, ErrInvalidCandidate)
+
+	_, err = w.Switchover(ctx, "unknown")
+	assert.ErrorIs(err, ErrInvalidCandidate)
+
+	si, err := w.Switchover(ctx, candidate)
+	assert.Nil(err)
+	assert.Equal(candidate, si.Candidate)
+	assert.True(si.Deadline.After(time.Now()))
+}
+
+func TestPromotionCandidateSwitchover(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	standby := func(name string, priority string) *Member {
+		return &Member{
+			Name:  name,
+			Host:  name,
+			Role:  Replica.String(),
+			State: MemberRunning,
+			LSN:   0x3000000,
+			Tags:  map[string]string{TagFailoverPriority: priority},
+		}
+	}
+	candidate := standby("candidate", "0")
+	preferred := standby("preferred", "10")
+
+	members := make(map[string][]byte)
+	for _, m := range []*Member{candidate, preferred} {
+		b, err := json.Marshal(m)
+		assert.Nil(err)
+		members[string(memberKey(m.Name))] = b
+	}
+	si, err := json.Marshal(&SwitchoverInfo{Candidate: candidate.Name, Deadline: time.Now().Add(time.Minute)})
+	assert.Nil(err)
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	// no switchover, the caught up replica with the higher priority is
+	// preferred
+	s.EXPECT().DictionaryGet(ctx, dictKeySwitchover).
+		Return(nil, nil).
+		Times(2)
+	s.EXPECT().DictionaryRange(ctx, dictKeyMemberPrefix).
+		Return(members, nil).
+		Times(2)
+
+	w := New(c, s, candidate.Name, pg.DefaultPort)
+	r, err := w.promotionCandidate(ctx, candidate)
+	assert.Nil(err)
+	assert.False(r)
+
+	other := New(c, s, preferred.Name, pg.DefaultPort)
+	r, err = other.promotionCandidate(ctx, preferred)
+	assert.Nil(err)
+	assert.True(r)
+
+	// the switchover candidate competes regardless of the priorities
+	s.EXPECT().DictionaryGet(ctx, dictKeySwitchover).
+		Return(si, nil).
+		Times(2)
+
+	r, err = w.promotionCandidate(ctx, candidate)
+	assert.Nil(err)
+	assert.True(r)
+
+	r, err = other.promotionCandidate(ctx, preferred)
+	assert.Nil(err)
+	assert.False(r)
+}
+
+func TestSwitchoverHandOver(t *testing.T) {
+	const (
+		selfHost   = "master"
+		candidate  = "replica"
+		checkpoint = pg.LSN(0x3000028)
+	)
+
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	si, err := json.Marshal(&SwitchoverInfo{Candidate: candidate, Deadline: time.Now().Add(time.Minute)})
+	assert.Nil(err)
+
+	replayed := func(lsn pg.LSN) []byte {
+		b, err := json.Marshal(&Member{
+			Name:     candidate,
+			Role:     Replica.String(),
+			State:    MemberRunning,
+			LSN:      lsn,
+			Position: pg.WalPosition{Received: lsn, Replayed: lsn},
+		})
+		assert.Nil(err)
+		return b
+	}
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	// writes are fenced by the shutdown, not by read-only
+	c.EXPECT().SetReadOnly(gm.Any(), gm.Any()).Times(0)
+
+	s.EXPECT().DictionaryGet(ctx, dictKeySwitchover).
+		Return(si, nil).
+		Times(2)
+	c.EXPECT().Stop(ctx).
+		Return(nil).
+		Times(2)
+
+	// the candidate replays the shutdown checkpoint
+	gm.InOrder(
+		s.EXPECT().DictionaryGet(ctx, memberKey(candidate)).Return(replayed(0x3000000), nil),
+		s.EXPECT().DictionaryGet(ctx, memberKey(candidate)).Return(replayed(checkpoint), nil),
+		s.EXPECT().DictionaryGet(ctx, memberKey(candidate)).Return(replayed(checkpoint+0x60), nil),
+	)
+	c.EXPECT().ControlData(ctx).
+		Return(&pg.ControlData{State: pg.StateShutDown, CheckpointLSN: checkpoint}, nil).
+		Times(1)
+	s.EXPECT().DictionaryRemove(ctx, dictKeyMasterInfo).
+		Return(nil).
+		Times(1)
+	s.EXPECT().MutexUnlock(ctx).
+		Return(nil).
+		Times(1)
+
+	w := New(c, s, selfHost, pg.DefaultPort)
+	w.state = Master
+
+	assert.Nil(w.switchover(ctx))
+	assert.Equal(Replica, w.state)
+
+	// an unclean shutdown does not guarantee the candidate has got all the
+	// writes, the master is restarted
+	s.EXPECT().DictionaryGet(ctx, memberKey(candidate)).
+		Return(replayed(0x3000000), nil).
+		Times(1)
+	c.EXPECT().ControlData(ctx).
+		Return(&pg.ControlData{State: "in production", CheckpointLSN: checkpoint}, nil).
+		Times(1)
+	c.EXPECT().Start(gm.Any()).
+		Return(nil).
+		Times(1)
+	s.EXPECT().DictionaryRemove(ctx, dictKeySwitchover).
+		Return(nil).
+		Times(1)
+
+	w.state = Master
+	assert.NotNil(w.switchover(ctx))
+	assert.Equal(Master, w.state)
+}
+
+func TestPrepareSecondMasterRewind(t *testing.T) {
+	const (
+		selfHost    = "localhost"
+		selfPort    = pg.DefaultPort
+		inRecovery  = false
+		mutexLocked = false
+		otherHost   = "localhost"
+		otherPort   = 5433
+	)
+
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var payload bytes.Buffer
+	err := gob.NewEncoder(&payload).Encode(&hostinfo{otherHost, otherPort})
+	assert.Nil(err)
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	c.EXPECT().ControlData(gm.Any()).
+		Return(&pg.ControlData{SystemIdentifier: testSystemID}, nil).
+		Times(1)
+	s.EXPECT().DictionaryGet(ctx, dictKeySystemID).
+		Return([]byte(strconv.FormatUint(testSystemID, 10)), nil).
+		Times(1)
+
+	c.EXPECT().InRecovery(gm.Any()).
 		Return(inRecovery, nil).
 		Times(1)
 	s.EXPECT().MutexTryLock(ctx).
@@ -129,13 +500,13 @@ func TestPrepareSecondMaster(t *testing.T) {
 		Return(payload.Bytes(), nil).
 		Times(1)
 
-	c.EXPECT().Stop().
+	c.EXPECT().Stop(gm.Any()).
 		Return(nil).
 		Times(1)
-	c.EXPECT().Backup(otherHost, otherPort).
+	c.EXPECT().Rewind(gm.Any(), otherHost, otherPort).
 		Return(nil).
 		Times(1)
-	c.EXPECT().Start().
+	c.EXPECT().Start(gm.Any()).
 		Return(nil).
 		Times(1)
 
@@ -146,3 +517,937 @@ func TestPrepareSecondMaster(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(Replica, w.State())
 }
+
+func TestDecodeMasterInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	var legacy bytes.Buffer
+	err := gob.NewEncoder(&legacy).Encode(&hostinfo{"master", 5432})
+	assert.Nil(err)
+
+	mi, err := decodeMasterInfo(legacy.Bytes())
+	assert.Nil(err)
+	assert.Equal(0, mi.Version)
+	assert.Equal("master", mi.Host)
+	assert.Equal(5432, mi.Port)
+
+	const in = `{"version":1,"host":"master","port":5432,"timeline":3,"lsn":"0/3000060",` +
+		`"promoted_at":"2021-05-20T10:00:00Z","term":7,"agent_version":"0.0.1"}`
+	mi, err = decodeMasterInfo([]byte(in))
+	assert.Nil(err)
+	assert.Equal(1, mi.Version)
+	assert.Equal("master", mi.Host)
+	assert.Equal(3, mi.Timeline)
+	assert.Equal(pg.LSN(0x3000060), mi.LSN)
+	assert.Equal(uint64(7), mi.Term)
+	assert.Equal("0.0.1", mi.AgentVersion)
+}
+
+func TestParseTags(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(map[string]string{}, parseTags(""))
+	assert.Equal(
+		map[string]string{"nofailover": "true", "dc": "west", "priority": "10"},
+		parseTags("nofailover, dc=west,priority = 10"))
+}
+
+func TestCheckTerm(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	s.EXPECT().DictionaryGet(ctx, dictKeyTerm).
+		Return([]byte("3"), nil).
+		Times(1)
+	s.EXPECT().DictionaryGet(ctx, dictKeyTerm).
+		Return([]byte("4"), nil).
+		Times(1)
+
+	w := New(c, s, "localhost", pg.DefaultPort)
+	w.setTerm(3)
+
+	assert.Nil(w.checkTerm(ctx))
+	assert.ErrorIs(w.checkTerm(ctx), ErrStaleTerm)
+}
+
+func TestCheckMasterPaused(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	s.EXPECT().DictionaryGet(ctx, dictKeyPause).
+		Return([]byte("2021-05-20T10:00:00Z"), nil).
+		Times(1)
+	s.EXPECT().DictionaryGet(ctx, dictKeyTerm).
+		Return([]byte("1"), nil).
+		Times(1)
+	c.EXPECT().Alive(gm.Any()).
+		Return(false, nil).
+		Times(1)
+	s.EXPECT().MutexUnlock(gm.Any()).
+		Times(0)
+
+	w := New(c, s, "localhost", pg.DefaultPort)
+	w.setTerm(1)
+	w.state = Master
+
+	assert.Nil(w.observePause(ctx))
+	assert.True(w.Paused())
+	assert.False(w.probe(ctx))
+	assert.Nil(w.checkMaster(ctx))
+	assert.Equal(Master, w.State())
+}
+
+func TestResyncCloneFrom(t *testing.T) {
+	const (
+		masterHost = "master"
+		masterPort = 5432
+		cloneHost  = "clone"
+		clonePort  = 5433
+	)
+
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clone, err := json.Marshal(&Member{
+		Name:  cloneHost,
+		Host:  cloneHost,
+		Port:  clonePort,
+		Role:  Replica.String(),
+		State: MemberRunning,
+		Tags:  map[string]string{TagCloneFrom: "true"},
+	})
+	assert.Nil(err)
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	c.EXPECT().Rewind(gm.Any(), masterHost, masterPort).
+		Return(errors.New("rewind error")).
+		Times(1)
+	s.EXPECT().DictionaryRange(ctx, dictKeyMemberPrefix).
+		Return(map[string][]byte{string(memberKey(cloneHost)): clone}, nil).
+		Times(1)
+	c.EXPECT().Backup(gm.Any(), cloneHost, clonePort).
+		Return(nil).
+		Times(1)
+	c.EXPECT().SetPrimary(gm.Any(), masterHost, masterPort).
+		Return(nil).
+		Times(1)
+
+	w := New(c, s, "localhost", pg.DefaultPort)
+	err = w.resync(ctx, &MasterInfo{Host: masterHost, Port: masterPort})
+	assert.Nil(err)
+}
+
+func TestStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	const (
+		masterHost = "master"
+		masterPort = 5432
+	)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	w := New(c, s, "localhost", pg.DefaultPort)
+	w.state = Replica
+	w.masterInfo = &MasterInfo{Host: masterHost, Port: masterPort}
+
+	w.recordCheck(nil)
+	w.recordCheck(errors.New("check error"))
+
+	st := w.Status()
+	assert.Equal(Replica.String(), st.State)
+	assert.Equal(masterHost, st.Master.Host)
+	assert.Equal(1, st.CheckSuccess)
+	assert.Equal(1, st.CheckErrors)
+	assert.Equal("check error", st.LastError)
+	assert.False(st.LastCheck.IsZero())
+
+	w.Reset()
+	st = w.Status()
+	assert.Equal(0, st.CheckSuccess)
+	assert.Equal(0, st.CheckErrors)
+	assert.Empty(st.LastError)
+	assert.False(st.LastCheck.IsZero())
+
+	// the unset times are omitted
+	b, err := json.Marshal(st)
+	assert.Nil(err)
+	for _, k := range []string{"last_error_at", "down_since", "detached_since", "next_recovery", "config_applied", "hba_applied"} {
+		assert.NotContains(string(b), k)
+	}
+}
+
+func TestEscalate(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	c.EXPECT().Stop(gm.Any()).
+		Return(nil).
+		Times(1)
+
+	w := New(c, s, "localhost", pg.DefaultPort,
+		WithUnhealthyAfter("2"),
+		WithStopAfter("3"),
+		WithExitAfter("4"),
+	)
+
+	fail := func() error {
+		err := errors.New("check error")
+		w.recordCheck(err)
+		return w.escalate(context.Background(), err)
+	}
+
+	assert.Nil(fail())
+	assert.False(w.Unhealthy())
+	assert.Nil(fail())
+	assert.True(w.Unhealthy())
+
+	// recovers on success
+	w.recordCheck(nil)
+	assert.False(w.Unhealthy())
+
+	assert.Nil(fail())
+	assert.Nil(fail())
+	assert.True(w.Unhealthy())
+	assert.Nil(fail())
+	assert.True(errors.Is(fail(), ErrEscalated))
+
+	st := w.Status()
+	assert.Equal(4, st.ConsecutiveErrors)
+	assert.Equal(2, st.Escalations[EscalationUnhealthy])
+	assert.Equal(1, st.Escalations[EscalationStop])
+	assert.Equal(1, st.Escalations[EscalationExit])
+}
+
+func TestCheckEscalate(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	s.EXPECT().DictionaryGet(ctx, dictKeyPause).
+		Return(nil, nil).
+		AnyTimes()
+	c.EXPECT().BackupJob(ctx).
+		Return(nil).
+		AnyTimes()
+	c.EXPECT().Alive(gm.Any()).
+		Return(false, nil).
+		AnyTimes()
+	s.EXPECT().DictionaryPutTTL(ctx, gm.Any(), gm.Any()).
+		Return(nil).
+		AnyTimes()
+	// the master check fails
+	s.EXPECT().DictionaryGet(ctx, dictKeyTerm).
+		Return(nil, errors.New("storage error")).
+		Times(3)
+	stopped := make(chan struct{})
+	c.EXPECT().Stop(gm.Any()).
+		DoAndReturn(func(context.Context) error {
+			close(stopped)
+			return nil
+		}).
+		Times(1)
+
+	w := New(c, s, "localhost", pg.DefaultPort,
+		WithUnhealthyAfter("2"),
+		WithStopAfter("3"),
+	)
+	w.state = Master
+	go func() { _ = w.Escalate(ctx) }()
+
+	w.check(ctx)
+	assert.Never(w.Unhealthy, 100*time.Millisecond, 10*time.Millisecond)
+
+	w.check(ctx)
+	assert.Eventually(w.Unhealthy, time.Second, 10*time.Millisecond)
+
+	w.check(ctx)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("not stopped")
+	}
+	assert.Equal(3, w.Status().ConsecutiveErrors)
+}
+
+func TestCheckMasterFailureThreshold(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	s.EXPECT().DictionaryGet(ctx, dictKeyTerm).
+		Return([]byte("1"), nil).
+		Times(3)
+	c.EXPECT().Alive(gm.Any()).
+		Return(false, nil).
+		Times(3)
+	s.EXPECT().MutexUnlock(ctx).
+		Return(nil).
+		Times(1)
+
+	w := New(c, s, "localhost", pg.DefaultPort,
+		WithFailureThreshold("2"),
+		WithMinDownTime("50ms"),
+	)
+	w.setTerm(1)
+	w.state = Master
+
+	// the first failed probe
+	assert.False(w.probe(ctx))
+	assert.Nil(w.checkMaster(ctx))
+
+	// the threshold is reached, but not the min down time
+	assert.False(w.probe(ctx))
+	assert.Nil(w.checkMaster(ctx))
+	assert.Equal(2, w.Status().ProbeFailures)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(w.probe(ctx))
+	assert.Nil(w.checkMaster(ctx))
+}
+
+func TestFailoverCandidateMasterDown(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	self := &Member{
+		Name:  "replica",
+		Host:  "replica",
+		Role:  Replica.String(),
+		State: MemberRunning,
+		LSN:   0x3000000,
+	}
+	master := &Member{
+		Name:  "master",
+		Host:  "master",
+		Role:  Master.String(),
+		State: MemberRunning,
+		LSN:   0x3000000,
+	}
+	members := func(ms ...*Member) map[string][]byte {
+		r := make(map[string][]byte)
+		for _, m := range ms {
+			b, err := json.Marshal(m)
+			assert.Nil(err)
+			r[string(memberKey(m.Name))] = b
+		}
+		return r
+	}
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	gm.InOrder(
+		s.EXPECT().DictionaryRange(ctx, dictKeyMemberPrefix).Return(members(self, master), nil),
+		s.EXPECT().DictionaryRange(ctx, dictKeyMemberPrefix).Return(members(self), nil).Times(3),
+		s.EXPECT().DictionaryRange(ctx, dictKeyMemberPrefix).Return(members(self, master), nil),
+		s.EXPECT().DictionaryRange(ctx, dictKeyMemberPrefix).Return(members(self), nil),
+	)
+
+	w := New(c, s, self.Name, pg.DefaultPort,
+		WithFailureThreshold("2"),
+		WithMinDownTime("50ms"),
+	)
+
+	// the master is running
+	r, err := w.failoverCandidate(ctx, self)
+	assert.Nil(err)
+	assert.False(r)
+
+	// the master is gone
+	r, err = w.failoverCandidate(ctx, self)
+	assert.Nil(err)
+	assert.False(r)
+
+	// the threshold is reached, but not the min down time
+	r, err = w.failoverCandidate(ctx, self)
+	assert.Nil(err)
+	assert.False(r)
+	assert.NotNil(w.Status().MasterDownSince)
+
+	time.Sleep(50 * time.Millisecond)
+	r, err = w.failoverCandidate(ctx, self)
+	assert.Nil(err)
+	assert.True(r)
+
+	// the master is back, the detection starts over
+	r, err = w.failoverCandidate(ctx, self)
+	assert.Nil(err)
+	assert.False(r)
+	assert.Nil(w.Status().MasterDownSince)
+
+	r, err = w.failoverCandidate(ctx, self)
+	assert.Nil(err)
+	assert.False(r)
+}
+
+func TestProbeTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	// the probe context is canceled after the timeout
+	c.EXPECT().Alive(gm.Any()).
+		DoAndReturn(func(ctx context.Context) (bool, error) {
+			<-ctx.Done()
+			return false, ctx.Err()
+		}).
+		Times(1)
+
+	w := New(c, s, "localhost", pg.DefaultPort, WithProbeTimeout("20ms"))
+	assert.False(w.probe(ctx))
+	assert.Equal(1, w.Status().ProbeFailures)
+}
+
+func TestCheckDetached(t *testing.T) {
+	const (
+		masterHost = "master"
+		masterPort = 5432
+	)
+
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mi, err := json.Marshal(&MasterInfo{Version: MasterInfoVersion, Host: masterHost, Port: masterPort, Term: 2})
+	assert.Nil(err)
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	gm.InOrder(
+		s.EXPECT().MutexTryLock(ctx).Return(true, nil),
+		s.EXPECT().MutexUnlock(ctx).Return(nil),
+		s.EXPECT().MutexTryLock(ctx).Return(false, nil),
+	)
+	s.EXPECT().DictionaryGet(gm.Any(), dictKeyMasterInfo).
+		Return(mi, nil).
+		Times(1)
+	c.EXPECT().Stop(gm.Any()).
+		Return(errors.New("not running")).
+		Times(1)
+	c.EXPECT().Alive(gm.Any()).
+		Return(false, nil).
+		Times(1)
+	c.EXPECT().Backup(gm.Any(), masterHost, masterPort).
+		Return(nil).
+		Times(1)
+	c.EXPECT().Start(gm.Any()).
+		Return(nil).
+		Times(1)
+
+	w := New(c, s, "localhost", pg.DefaultPort, WithReinitAfter("1"))
+	w.detach("failed to resync", errors.New("rewind error"))
+	assert.Equal(Detached, w.State())
+	assert.Equal("failed to resync: rewind error", w.Status().DetachedReason)
+
+	// the lock is released
+	assert.True(errors.Is(w.checkDetached(ctx), errNoMaster))
+	st := w.Status()
+	assert.Equal(Detached.String(), st.State)
+	assert.Equal(1, st.RecoveryAttempts)
+	assert.Equal(errNoMaster.Error(), st.DetachedReason)
+	assert.True(st.NextRecovery.After(time.Now()))
+
+	// the recovery is delayed
+	assert.Nil(w.checkDetached(ctx))
+	assert.Equal(Detached, w.State())
+
+	// reinitialised from the master
+	w.nextRecovery = time.Time{}
+	assert.Nil(w.checkDetached(ctx))
+	st = w.Status()
+	assert.Equal(Replica.String(), st.State)
+	assert.Equal(uint64(2), st.Term)
+	assert.Empty(st.DetachedReason)
+	assert.Equal(0, st.RecoveryAttempts)
+}
+
+func TestPrepareSystemIDMismatch(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	c.EXPECT().ControlData(gm.Any()).
+		Return(&pg.ControlData{SystemIdentifier: testSystemID + 1}, nil).
+		Times(1)
+	s.EXPECT().DictionaryGet(ctx, dictKeySystemID).
+		Return([]byte(strconv.FormatUint(testSystemID, 10)), nil).
+		Times(1)
+	c.EXPECT().InRecovery(gm.Any()).
+		Times(0)
+
+	w := New(c, s, "localhost", pg.DefaultPort)
+	err := w.Prepare(ctx)
+	assert.True(errors.Is(err, ErrSystemIDMismatch))
+}
+
+func TestSyncSlots(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	members := func(names ...string) map[string][]byte {
+		r := make(map[string][]byte)
+		for _, n := range names {
+			b, err := json.Marshal(&Member{Name: n, Host: n})
+			assert.Nil(err)
+			r[string(memberKey(n))] = b
+		}
+		return r
+	}
+
+	r1, r2 := pg.SlotName("replica-1"), pg.SlotName("replica-2")
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	// a slot is created for every member but the master
+	s.EXPECT().DictionaryRange(ctx, dictKeyMemberPrefix).
+		Return(members("localhost", "replica-1", "replica-2"), nil).
+		Times(1)
+	c.EXPECT().ReplicationSlots(gm.Any()).
+		Return([]*pg.ReplicationSlot{{Name: r1}, {Name: "manual"}}, nil).
+		Times(1)
+	c.EXPECT().CreateReplicationSlot(gm.Any(), r2).
+		Return(nil).
+		Times(1)
+
+	// replica-2 has gone
+	s.EXPECT().DictionaryRange(ctx, dictKeyMemberPrefix).
+		Return(members("localhost", "replica-1"), nil).
+		Times(2)
+	c.EXPECT().ReplicationSlots(gm.Any()).
+		Return([]*pg.ReplicationSlot{{Name: r1}, {Name: r2}, {Name: "manual"}}, nil).
+		Times(2)
+	c.EXPECT().DropReplicationSlot(gm.Any(), r2).
+		Return(nil).
+		Times(1)
+	c.EXPECT().DropReplicationSlot(gm.Any(), "manual").
+		Times(0)
+
+	w := New(c, s, "localhost", pg.DefaultPort, WithSlotDropAfter("50ms"))
+	assert.Nil(w.syncSlots(ctx))
+	assert.Empty(w.slots)
+	assert.Nil(w.syncSlots(ctx))
+	assert.Contains(w.slots, r2)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(w.syncSlots(ctx))
+	assert.NotContains(w.slots, r2)
+}
+
+func TestSyncSlotsOrphan(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	self, err := json.Marshal(&Member{Name: "localhost", Host: "localhost"})
+	assert.Nil(err)
+	orphan := pg.SlotName("replica-1")
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	// the member has gone before the instance started
+	s.EXPECT().DictionaryRange(ctx, dictKeyMemberPrefix).
+		Return(map[string][]byte{string(memberKey("localhost")): self}, nil).
+		Times(2)
+	c.EXPECT().ReplicationSlots(gm.Any()).
+		Return([]*pg.ReplicationSlot{{Name: orphan}, {Name: "manual"}}, nil).
+		Times(2)
+	c.EXPECT().DropReplicationSlot(gm.Any(), orphan).
+		Return(nil).
+		Times(1)
+	c.EXPECT().DropReplicationSlot(gm.Any(), "manual").
+		Times(0)
+
+	w := New(c, s, "localhost", pg.DefaultPort, WithSlotDropAfter("50ms"))
+	assert.Empty(w.slots)
+	assert.Nil(w.syncSlots(ctx))
+	assert.Contains(w.slots, orphan)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(w.syncSlots(ctx))
+	assert.Empty(w.slots)
+}
+
+func TestPatchConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	stored := []byte(`{"parameters":{"work_mem":"4MB","max_connections":"100"},"nodes":{"replica":{"work_mem":"8MB"}}}`)
+	s.EXPECT().DictionaryGet(ctx, dictKeyConfig).
+		Return(stored, nil).
+		Times(3)
+	s.EXPECT().DictionaryPut(ctx, dictKeyConfig, gm.Any()).
+		Return(nil).
+		Times(1)
+
+	w := New(c, s, "localhost", pg.DefaultPort)
+	r, err := w.PatchConfig(ctx, []byte(`{"parameters":{"max_connections":null,"shared_buffers":"1GB"},"nodes":{"replica":null}}`))
+	assert.Nil(err)
+	assert.Equal(map[string]string{"work_mem": "4MB", "shared_buffers": "1GB"}, r.Parameters)
+	assert.Empty(r.Nodes)
+
+	_, err = w.PatchConfig(ctx, []byte(`{"parameters":{"primary_conninfo":"host=other"}}`))
+	assert.ErrorIs(err, ErrInvalidConfig)
+	_, err = w.PatchConfig(ctx, []byte(`{"parameters":{"work_mem = '1MB'; --":"x"}}`))
+	assert.ErrorIs(err, ErrInvalidConfig)
+}
+
+func TestApplyConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	config := []byte(`{"parameters":{"work_mem":"4MB","shared_buffers":"1GB"},"nodes":{"localhost":{"work_mem":"8MB"}}}`)
+	unknown := []byte(`{"parameters":{"work_mem":"8MB","no_such":"1"}}`)
+	gm.InOrder(
+		// not managed
+		s.EXPECT().DictionaryGet(ctx, dictKeyConfig).
+			Return(nil, nil),
+
+		// the settings copied from the master are replaced, the ones
+		// written by the agent are kept
+		s.EXPECT().DictionaryGet(ctx, dictKeyConfig).
+			Return(config, nil),
+		c.EXPECT().SystemSettings(gm.Any()).
+			Return(map[string]string{"work_mem": "4MB", "max_connections": "200", "primary_conninfo": "host=master"}, nil),
+		c.EXPECT().AlterSystem(gm.Any(), map[string]string{"work_mem": "8MB", "shared_buffers": "1GB"}, []string{"max_connections"}).
+			Return(nil),
+		c.EXPECT().PendingRestart(gm.Any()).
+			Return([]string{"shared_buffers"}, nil),
+
+		// applied, but checked until restarted
+		s.EXPECT().DictionaryGet(ctx, dictKeyConfig).
+			Return(config, nil),
+		c.EXPECT().SystemSettings(gm.Any()).
+			Return(map[string]string{"work_mem": "8MB", "shared_buffers": "1GB", "primary_conninfo": "host=master"}, nil),
+		c.EXPECT().PendingRestart(gm.Any()).
+			Return([]string{}, nil),
+
+		// an unknown parameter is not retried
+		s.EXPECT().DictionaryGet(ctx, dictKeyConfig).
+			Return(unknown, nil),
+		c.EXPECT().SystemSettings(gm.Any()).
+			Return(map[string]string{"work_mem": "8MB", "shared_buffers": "1GB"}, nil),
+		c.EXPECT().AlterSystem(gm.Any(), map[string]string{"no_such": "1"}, []string{"shared_buffers"}).
+			Return(&pg.ParameterError{Errors: map[string]error{"no_such": errors.New("unrecognized")}}),
+		c.EXPECT().PendingRestart(gm.Any()).
+			Return([]string{}, nil),
+
+		s.EXPECT().DictionaryGet(ctx, dictKeyConfig).
+			Return(unknown, nil),
+		c.EXPECT().SystemSettings(gm.Any()).
+			Return(map[string]string{"work_mem": "8MB"}, nil),
+	)
+
+	w := New(c, s, "localhost", pg.DefaultPort)
+	assert.Nil(w.applyConfig(ctx))
+	assert.Nil(w.Status().ConfigApplied)
+
+	assert.Nil(w.applyConfig(ctx))
+	assert.Equal([]string{"shared_buffers"}, w.Status().PendingRestart)
+	assert.Nil(w.applyConfig(ctx))
+	assert.Empty(w.Status().PendingRestart)
+
+	assert.NotNil(w.applyConfig(ctx))
+	assert.Nil(w.applyConfig(ctx))
+	assert.Contains(w.Status().ConfigError, "no_such")
+}
+
+func TestApplyHBA(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	replica, err := json.Marshal(&Member{Name: "replica", Host: "replica"})
+	assert.Nil(err)
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	s.EXPECT().DictionaryGet(ctx, dictKeyHBA).
+		Return(nil, nil).
+		Times(2)
+	s.EXPECT().DictionaryRange(ctx, dictKeyMemberPrefix).
+		Return(map[string][]byte{string(memberKey("replica")): replica}, nil).
+		Times(2)
+	c.EXPECT().SetHBA(gm.Any(), []*pg.HBARule{
+		{Type: "host", Database: "replication", User: "replicator", Address: "samenet", Method: memberAuthMethod},
+		{Type: "host", Database: "all", User: "replicator", Address: "samenet", Method: memberAuthMethod},
+		{Type: "host", Database: "replication", User: "replicator", Address: "10.0.0.2/32", Method: memberAuthMethod},
+		{Type: "host", Database: "all", User: "replicator", Address: "10.0.0.2/32", Method: memberAuthMethod},
+		{Type: "local", Database: "all", User: "all", Method: "peer"},
+	}).
+		Return(nil).
+		Times(1)
+
+	w := New(c, s, "localhost", pg.DefaultPort, WithHBARules("local all all peer"))
+	w.lookupIP = func(host string) ([]net.IP, error) {
+		assert.Equal("replica", host)
+		return []net.IP{net.ParseIP("10.0.0.2")}, nil
+	}
+	assert.Nil(w.applyHBA(ctx))
+	// unchanged
+	assert.Nil(w.applyHBA(ctx))
+	assert.NotNil(w.Status().HBAApplied)
+
+	// not managed
+	w = New(c, s, "localhost", pg.DefaultPort)
+	s.EXPECT().DictionaryGet(ctx, dictKeyHBA).
+		Return(nil, nil).
+		Times(1)
+	assert.Nil(w.applyHBA(ctx))
+}
+
+func TestEffectiveHBAUnregisteredMember(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	self, err := json.Marshal(&Member{Name: "localhost", Host: "localhost"})
+	assert.Nil(err)
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	// the record of replica-1 has expired
+	s.EXPECT().DictionaryGet(ctx, dictKeyHBA).
+		Return(nil, nil).
+		Times(2)
+	s.EXPECT().DictionaryRange(ctx, dictKeyMemberPrefix).
+		Return(map[string][]byte{string(memberKey("localhost")): self}, nil).
+		Times(2)
+
+	w := New(c, s, "localhost", pg.DefaultPort,
+		WithHBARules("local all all peer"),
+		WithReplicationNetworks("10.0.0.0/24, replica-1"),
+	)
+	w.lookupIP = func(string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("127.0.0.1")}, nil
+	}
+	rules, err := w.effectiveHBA(ctx)
+	assert.Nil(err)
+	assert.Equal(pg.RenderHBA([]*pg.HBARule{
+		{Type: "host", Database: "replication", User: "replicator", Address: "10.0.0.0/24", Method: memberAuthMethod},
+		{Type: "host", Database: "all", User: "replicator", Address: "10.0.0.0/24", Method: memberAuthMethod},
+		{Type: "host", Database: "replication", User: "replicator", Address: "replica-1", Method: memberAuthMethod},
+		{Type: "host", Database: "all", User: "replicator", Address: "replica-1", Method: memberAuthMethod},
+		{Type: "host", Database: "replication", User: "replicator", Address: "127.0.0.1/32", Method: memberAuthMethod},
+		{Type: "host", Database: "all", User: "replicator", Address: "127.0.0.1/32", Method: memberAuthMethod},
+		{Type: "local", Database: "all", User: "all", Method: "peer"},
+	}), pg.RenderHBA(rules))
+
+	// disabled, only the registered members
+	WithReplicationNetworks("")(w)
+	rules, err = w.effectiveHBA(ctx)
+	assert.Nil(err)
+	assert.Len(rules, 3)
+
+	assert.Panics(func() { WithReplicationNetworks("10.0.0.0/24 replica-1") })
+}
+
+func TestStartBackupJob(t *testing.T) {
+	const (
+		masterHost = "master"
+		masterPort = 5433
+	)
+
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mi, err := json.Marshal(&MasterInfo{Version: MasterInfoVersion, Host: masterHost, Port: masterPort, Term: 1})
+	assert.Nil(err)
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	// the source defaults to the master from the storage, not the local
+	// WAL receiver
+	s.EXPECT().DictionaryGet(ctx, dictKeyMasterInfo).
+		Return(mi, nil).
+		Times(1)
+	var ready func()
+	c.EXPECT().StartBackupJob(gm.Any(), masterHost, masterPort, gm.Any()).
+		DoAndReturn(func(_ context.Context, host string, port int, f func()) (*pg.BackupJob, error) {
+			ready = f
+			return &pg.BackupJob{ID: "1", Host: host, Port: port, Status: pg.BackupJobRunning}, nil
+		}).
+		Times(1)
+
+	w := New(c, s, "localhost", pg.DefaultPort)
+	w.state = Replica
+
+	// returned while a check is in progress, the job waits for the check
+	w.mu.Lock()
+	job, err := w.StartBackupJob(ctx, "", 0)
+	assert.Nil(err)
+	assert.Equal(masterHost, job.Host)
+	done := make(chan struct{})
+	go func() {
+		ready()
+		close(done)
+	}()
+	assert.Never(func() bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}, 50*time.Millisecond, 10*time.Millisecond)
+	w.mu.Unlock()
+	<-done
+
+	_, err = w.StartBackupJob(ctx, "localhost", pg.DefaultPort)
+	assert.ErrorIs(err, ErrInvalidBackupSource)
+
+	// the master is never reinitialised
+	w.state = Master
+	_, err = w.StartBackupJob(ctx, masterHost, masterPort)
+	assert.ErrorIs(err, pg.ErrNotStandby)
+}
+
+func TestCheckBackupRunning(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := gm.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := mock_pg.NewMockCluster(ctrl)
+	s := mock_storage.NewMockStorage(ctrl)
+
+	s.EXPECT().DictionaryGet(ctx, dictKeyPause).
+		Return(nil, nil).
+		Times(1)
+	c.EXPECT().BackupJob(gm.Any()).
+		Return(&pg.BackupJob{ID: "1", Status: pg.BackupJobRunning}).
+		Times(1)
+	// registered as down, the instance is neither probed nor followed
+	s.EXPECT().DictionaryPutTTL(ctx, memberKey("localhost"), gm.Any()).
+		DoAndReturn(func(_ context.Context, _, v []byte) error {
+			var m Member
+			assert.Nil(json.Unmarshal(v, &m))
+			assert.Equal(MemberDown, m.State)
+			return nil
+		}).
+		Times(1)
+	c.EXPECT().Alive(gm.Any()).
+		Times(0)
+
+	w := New(c, s, "localhost", pg.DefaultPort)
+	w.state = Replica
+	w.check(ctx)
+	assert.Equal(Replica, w.State())
+	assert.Equal(0, w.Status().ProbeFailures)
+}
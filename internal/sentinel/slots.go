@@ -0,0 +1,84 @@
+package sentinel
+
+import (
+	"context"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/pg"
+	"github.com/vontikov/pgcluster/internal/util"
+)
+
+// DefaultSlotDropAfter is the default time the slot of a gone member is kept.
+const DefaultSlotDropAfter = 30 * time.Minute
+
+// WithSlotDropAfter sets the time the replication slot of a member is kept
+// after the member has gone.
+func WithSlotDropAfter(v string) Option {
+	d, err := time.ParseDuration(v)
+	util.PanicOnError(err)
+	return func(w *Sentinel) { w.slotDropAfter = d }
+}
+
+// syncSlots makes sure the master has a physical replication slot for every
+// registered member but itself, and drops the inactive slots of the members
+// gone longer than the drop delay. The slots are told by the name prefix, so
+// the ones of the members gone before the instance has become the master are
+// dropped as well, and the slots not created for members are left alone.
+func (w *Sentinel) syncSlots(ctx context.Context) error {
+	members, err := w.Members(ctx)
+	if err != nil {
+		return err
+	}
+	slots, err := w.c.ReplicationSlots(ctx)
+	if err != nil {
+		return err
+	}
+
+	want := make(map[string]bool, len(members))
+	for _, m := range members {
+		if m.Name != w.hostname {
+			want[pg.SlotName(m.Name)] = true
+		}
+	}
+	have := make(map[string]bool, len(slots))
+	for _, s := range slots {
+		have[s.Name] = true
+	}
+
+	for name := range want {
+		if have[name] {
+			continue
+		}
+		if err := w.c.CreateReplicationSlot(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	for _, s := range slots {
+		if !pg.ManagedSlot(s.Name) || want[s.Name] {
+			continue
+		}
+		goneSince, ok := w.slots[s.Name]
+		if !ok {
+			w.logger.Warn("replication slot member has gone", "slot", s.Name)
+			w.slots[s.Name] = now
+			continue
+		}
+		if s.Active || now.Sub(goneSince) < w.slotDropAfter {
+			continue
+		}
+		if err := w.c.DropReplicationSlot(ctx, s.Name); err != nil {
+			return err
+		}
+		delete(w.slots, s.Name)
+	}
+
+	// forget the slots dropped elsewhere or wanted again
+	for name := range w.slots {
+		if !have[name] || want[name] {
+			delete(w.slots, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package sentinel
+
+import (
+	"time"
+)
+
+// Status describes the instance state as of the last check.
+type Status struct {
+	State        string      `json:"state"`
+	Term         uint64      `json:"term"`
+	Paused       bool        `json:"paused"`
+	Master       *MasterInfo `json:"master,omitempty"`
+	LastCheck    time.Time   `json:"last_check"`
+	CheckSuccess int         `json:"check_success"`
+	CheckErrors  int         `json:"check_errors"`
+	LastError    string      `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time  `json:"last_error_at,omitempty"`
+
+	ConsecutiveErrors int            `json:"consecutive_errors"`
+	Unhealthy         bool           `json:"unhealthy"`
+	Escalations       map[string]int `json:"escalations,omitempty"`
+
+	FailureThreshold int        `json:"failure_threshold"`
+	ProbeTimeout     string     `json:"probe_timeout"`
+	MinDownTime      string     `json:"min_down_time"`
+	ProbeFailures    int        `json:"probe_failures"`
+	DownSince        *time.Time `json:"down_since,omitempty"`
+	MasterDownSince  *time.Time `json:"master_down_since,omitempty"`
+
+	DetachedReason   string     `json:"detached_reason,omitempty"`
+	DetachedSince    *time.Time `json:"detached_since,omitempty"`
+	RecoveryAttempts int        `json:"recovery_attempts"`
+	NextRecovery     *time.Time `json:"next_recovery,omitempty"`
+
+	ConfigApplied  *time.Time `json:"config_applied,omitempty"`
+	ConfigError    string     `json:"config_error,omitempty"`
+	PendingRestart []string   `json:"pending_restart,omitempty"`
+
+	HBAApplied *time.Time `json:"hba_applied,omitempty"`
+	HBAError   string     `json:"hba_error,omitempty"`
+}
+
+// Status returns the instance status. It does not wait for the check in
+// progress to complete.
+func (w *Sentinel) Status() *Status {
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	escalations := make(map[string]int, len(w.escalations))
+	for k, v := range w.escalations {
+		escalations[k] = v
+	}
+	return &Status{
+		State:        w.State().String(),
+		Term:         w.Term(),
+		Paused:       w.Paused(),
+		Master:       w.master,
+		LastCheck:    w.lastCheck,
+		CheckSuccess: w.counterCheckSuccess,
+		CheckErrors:  w.counterCheckErrors,
+		LastError:    w.lastError,
+		LastErrorAt:  timeOrNil(w.lastErrorAt),
+
+		ConsecutiveErrors: w.consecutiveErrors,
+		Unhealthy:         w.Unhealthy(),
+		Escalations:       escalations,
+
+		FailureThreshold: w.failureThreshold,
+		ProbeTimeout:     w.probeTimeout.String(),
+		MinDownTime:      w.minDownTime.String(),
+		ProbeFailures:    w.probeFailures,
+		DownSince:        timeOrNil(w.downSince),
+		MasterDownSince:  timeOrNil(w.masterDownSince),
+
+		DetachedReason:   w.detachedReason,
+		DetachedSince:    timeOrNil(w.detachedSince),
+		RecoveryAttempts: w.recoveryAttempts,
+		NextRecovery:     timeOrNil(w.nextRecovery),
+
+		ConfigApplied:  timeOrNil(w.configApplied),
+		ConfigError:    w.configError,
+		PendingRestart: append([]string(nil), w.pendingRestart...),
+
+		HBAApplied: timeOrNil(w.hbaApplied),
+		HBAError:   w.hbaError,
+	}
+}
+
+// timeOrNil returns nil for the zero time, which is not omitted from JSON.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// recordCheck records the check result. It must be called under w.mu.
+func (w *Sentinel) recordCheck(err error) {
+	master := w.masterInfo
+	if w.state == Master && w.payload != nil {
+		if mi, derr := decodeMasterInfo(w.payload); derr == nil {
+			master = mi
+		}
+	}
+
+	w.smu.Lock()
+	defer w.smu.Unlock()
+	now := time.Now()
+	w.master = master
+	w.lastCheck = now
+	if err != nil {
+		w.counterCheckErrors++
+		w.consecutiveErrors++
+		w.lastError = err.Error()
+		w.lastErrorAt = now
+		return
+	}
+	w.counterCheckSuccess++
+	w.consecutiveErrors = 0
+	if w.escalationLevel > 0 {
+		w.logger.Warn("recovered from escalation")
+		w.escalationLevel = 0
+		w.setUnhealthy(false)
+	}
+}
@@ -0,0 +1,192 @@
+package sentinel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vontikov/pgcluster/internal/pg"
+)
+
+var dictKeySwitchover = []byte("switchover")
+
+var (
+	ErrNoCandidate          = errors.New("switchover candidate is not specified")
+	ErrInvalidCandidate     = errors.New("invalid switchover candidate")
+	ErrSwitchoverInProgress = errors.New("switchover is in progress")
+)
+
+// SwitchoverInfo describes a planned switchover.
+type SwitchoverInfo struct {
+	Candidate string    `json:"candidate"`
+	Deadline  time.Time `json:"deadline"`
+}
+
+func (si *SwitchoverInfo) expired() bool {
+	return time.Now().After(si.Deadline)
+}
+
+// Switchover requests the master to hand over to the candidate.
+// The request is executed by the master asynchronously and is abandoned if
+// not completed within the switchover timeout.
+func (w *Sentinel) Switchover(ctx context.Context, candidate string) (*SwitchoverInfo, error) {
+	if candidate == "" {
+		return nil, ErrNoCandidate
+	}
+	if w.Paused() {
+		return nil, ErrPaused
+	}
+
+	si, err := w.GetSwitchover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if si != nil {
+		return nil, ErrSwitchoverInProgress
+	}
+
+	mi, err := w.readMasterInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mi == nil {
+		return nil, errors.New("master is not available")
+	}
+	if mi.Host == candidate {
+		return nil, fmt.Errorf("%w: %s is the master already", ErrInvalidCandidate, candidate)
+	}
+
+	m, err := w.getMember(ctx, candidate)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || !m.standby() || m.Unhealthy {
+		return nil, fmt.Errorf("%w: %s is not a healthy replica", ErrInvalidCandidate, candidate)
+	}
+	if m.noFailover() {
+		return nil, fmt.Errorf("%w: %s is tagged %s", ErrInvalidCandidate, candidate, TagNoFailover)
+	}
+
+	si = &SwitchoverInfo{Candidate: candidate, Deadline: time.Now().Add(w.switchoverTimeout)}
+	payload, err := json.Marshal(si)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.storage.DictionaryPut(ctx, dictKeySwitchover, payload); err != nil {
+		return nil, err
+	}
+	w.logger.Warn("switchover requested", "candidate", candidate, "deadline", si.Deadline)
+	return si, nil
+}
+
+// GetSwitchover returns the switchover in progress or nil.
+func (w *Sentinel) GetSwitchover(ctx context.Context) (*SwitchoverInfo, error) {
+	payload, err := w.storage.DictionaryGet(ctx, dictKeySwitchover)
+	if err != nil || payload == nil {
+		return nil, err
+	}
+	var si SwitchoverInfo
+	if err := json.Unmarshal(payload, &si); err != nil {
+		return nil, err
+	}
+	if si.expired() {
+		return nil, nil
+	}
+	return &si, nil
+}
+
+func (w *Sentinel) removeSwitchover(ctx context.Context) {
+	if err := w.storage.DictionaryRemove(ctx, dictKeySwitchover); err != nil {
+		w.logger.Warn("failed to remove switchover", "message", err)
+	}
+}
+
+// switchover hands the master role over to the candidate if requested.
+// It shuts the master down, waits for the candidate to replay the shutdown
+// checkpoint, then releases the mutex for the candidate to take. Read-only
+// does not fence the writes, a session may opt out of it.
+func (w *Sentinel) switchover(ctx context.Context) (err error) {
+	si, err := w.GetSwitchover(ctx)
+	if err != nil || si == nil {
+		return
+	}
+	if si.Candidate == w.hostname {
+		w.removeSwitchover(ctx)
+		return
+	}
+
+	w.logger.Warn("switchover", "candidate", si.Candidate)
+
+	stopped := false
+	defer func() {
+		if err == nil {
+			return
+		}
+		w.logger.Error("switchover aborted", "message", err)
+		if stopped {
+			// even if the context is done
+			if err := w.c.Start(context.Background()); err != nil {
+				w.logger.Error("failed to restart", "message", err)
+			}
+		}
+		w.removeSwitchover(ctx)
+	}()
+
+	m, err := w.getMember(ctx, si.Candidate)
+	if err != nil {
+		return
+	}
+	if m == nil || !m.standby() {
+		return fmt.Errorf("%s is not a healthy replica", si.Candidate)
+	}
+	// the member record is a check behind under the write load, the
+	// candidate is not compared with the master until the writes are stopped
+
+	// stop writes: the fast shutdown terminates the sessions and sends the
+	// WAL up to the shutdown checkpoint to the standbys
+	stopped = true
+	if err = w.c.Stop(ctx); err != nil {
+		return
+	}
+	cd, err := w.c.ControlData(ctx)
+	if err != nil {
+		return
+	}
+	if cd.State != pg.StateShutDown {
+		return fmt.Errorf("unclean shutdown: %s", cd.State)
+	}
+	w.logger.Warn("awaiting the candidate to replay", "position", cd.CheckpointLSN)
+
+	for {
+		if si.expired() {
+			return fmt.Errorf("%s has not replayed %v within the deadline", si.Candidate, cd.CheckpointLSN)
+		}
+		if m, err = w.getMember(ctx, si.Candidate); err != nil {
+			return
+		}
+		// the checkpoint record starts at the location
+		if m != nil && m.Position.Replayed > cd.CheckpointLSN {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(DefaultPgPollDelay):
+		}
+	}
+
+	// hand over
+	if err = w.storage.DictionaryRemove(ctx, dictKeyMasterInfo); err != nil {
+		return
+	}
+	if err = w.storage.MutexUnlock(ctx); err != nil {
+		_ = w.storage.DictionaryPut(ctx, dictKeyMasterInfo, w.payload)
+		return
+	}
+	w.logger.Warn("handed over", "candidate", si.Candidate)
+	w.setState(Replica)
+	w.masterInfo = nil
+	return nil
+}
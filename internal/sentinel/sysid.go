@@ -0,0 +1,54 @@
+package sentinel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var dictKeySystemID = []byte("system-id")
+
+// ErrSystemIDMismatch is returned when the instance does not belong to the
+// cluster.
+var ErrSystemIDMismatch = errors.New("system identifier mismatch")
+
+// readSystemID returns the cluster system identifier, 0 if not bootstrapped.
+func (w *Sentinel) readSystemID(ctx context.Context) (uint64, error) {
+	payload, err := w.storage.DictionaryGet(ctx, dictKeySystemID)
+	if err != nil || payload == nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(payload), 10, 64)
+}
+
+// verifySystemID returns ErrSystemIDMismatch if the instance system
+// identifier differs from the cluster one.
+func (w *Sentinel) verifySystemID(ctx context.Context) error {
+	cd, err := w.c.ControlData(ctx)
+	if err != nil {
+		return err
+	}
+	w.systemID = cd.SystemIdentifier
+
+	id, err := w.readSystemID(ctx)
+	if err != nil {
+		return err
+	}
+	if id != 0 && id != w.systemID {
+		return fmt.Errorf("%w: %d, cluster: %d", ErrSystemIDMismatch, w.systemID, id)
+	}
+	w.logger.Info("system identifier", "id", w.systemID, "bootstrapped", id != 0)
+	return nil
+}
+
+// bootstrapSystemID stores the instance system identifier as the cluster one
+// unless already stored. It must be called by the master only.
+func (w *Sentinel) bootstrapSystemID(ctx context.Context) error {
+	id, err := w.readSystemID(ctx)
+	if err != nil || id != 0 {
+		return err
+	}
+	w.logger.Warn("bootstrapping system identifier", "id", w.systemID)
+	return w.storage.DictionaryPut(ctx, dictKeySystemID, []byte(strconv.FormatUint(w.systemID, 10)))
+}
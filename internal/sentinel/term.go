@@ -0,0 +1,82 @@
+package sentinel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+var dictKeyTerm = []byte("term")
+
+// ErrStaleTerm is returned when the instance acts on behalf of a term which
+// has been succeeded.
+var ErrStaleTerm = errors.New("stale term")
+
+// Term returns the failover term known to the instance: the term of the
+// master if the instance is the master, or the term of the master it
+// follows.
+func (w *Sentinel) Term() uint64 {
+	return atomic.LoadUint64(&w.term)
+}
+
+func (w *Sentinel) setTerm(v uint64) {
+	atomic.StoreUint64(&w.term, v)
+}
+
+// readTerm returns the cluster term, 0 if not available.
+func (w *Sentinel) readTerm(ctx context.Context) (uint64, error) {
+	payload, err := w.storage.DictionaryGet(ctx, dictKeyTerm)
+	if err != nil || payload == nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(payload), 10, 64)
+}
+
+// bumpTerm starts the next term. It must be called right after the master
+// mutex is acquired, so that the term is never bumped concurrently.
+func (w *Sentinel) bumpTerm(ctx context.Context) (uint64, error) {
+	t, err := w.readTerm(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if t == 0 {
+		// the previous master might have kept the term in the master info only
+		if t, err = w.lastTerm(ctx); err != nil {
+			return 0, err
+		}
+	}
+	t++
+
+	if err := w.storage.DictionaryPut(ctx, dictKeyTerm, []byte(strconv.FormatUint(t, 10))); err != nil {
+		return 0, err
+	}
+	w.setTerm(t)
+	w.logger.Warn("term started", "term", t)
+	return t, nil
+}
+
+// checkTerm returns ErrStaleTerm if the cluster term has moved on since the
+// instance became the master.
+func (w *Sentinel) checkTerm(ctx context.Context) error {
+	t, err := w.readTerm(ctx)
+	if err != nil {
+		return err
+	}
+	if self := w.Term(); t != self {
+		return fmt.Errorf("%w: %d, cluster term: %d", ErrStaleTerm, self, t)
+	}
+	return nil
+}
+
+// stepDown fences the stale master: it stops the writes and makes the instance
+// follow the actual master.
+func (w *Sentinel) stepDown(ctx context.Context) {
+	w.logger.Error("stepping down")
+	if err := w.c.SetReadOnly(ctx, true); err != nil {
+		w.logger.Error("failed to set read-only", "message", err)
+	}
+	w.setState(Replica)
+	w.masterInfo = nil
+}
@@ -27,6 +27,7 @@ const (
 
 type etcdStorage struct {
 	logger logging.Logger
+	sess   *concurrency.Session
 	m      *concurrency.Mutex
 	kv     etcd.KV
 }
@@ -62,6 +63,7 @@ func newEtcd(ctx context.Context, bootstrap string, ttl time.Duration) (Storage,
 
 	return &etcdStorage{
 		logger: logging.NewLogger(DefaultEtcdLoggerName),
+		sess:   sess,
 		m:      mux,
 		kv:     kv,
 	}, nil
@@ -136,3 +138,34 @@ func (s *etcdStorage) DictionaryRemove(ctx context.Context, k []byte) (err error
 	}
 	return
 }
+
+func (s *etcdStorage) DictionaryPutTTL(ctx context.Context, k, v []byte) (err error) {
+	s.logger.Trace("dictionary put ttl")
+	ctx, cancel := context.WithTimeout(ctx, DefaultEtcdOpTimeout)
+	defer cancel()
+
+	// the session lease is kept alive while the process is running and
+	// expires within the TTL otherwise
+	_, err = s.kv.Put(ctx, string(k), string(v), etcd.WithLease(s.sess.Lease()))
+	if err != nil {
+		s.logger.Error("dictionary put ttl error", "message", err)
+	}
+	return
+}
+
+func (s *etcdStorage) DictionaryRange(ctx context.Context, p []byte) (r map[string][]byte, err error) {
+	s.logger.Trace("dictionary range")
+	ctx, cancel := context.WithTimeout(ctx, DefaultEtcdOpTimeout)
+	defer cancel()
+
+	gr, err := s.kv.Get(ctx, string(p), etcd.WithPrefix())
+	if err != nil {
+		s.logger.Error("dictionary range error", "message", err)
+		return
+	}
+	r = make(map[string][]byte, len(gr.Kvs))
+	for _, kv := range gr.Kvs {
+		r[string(kv.Key)] = kv.Value
+	}
+	return
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"time"
 
@@ -21,6 +22,7 @@ const (
 
 type stoaStorage struct {
 	logger logging.Logger
+	ttl    time.Duration
 	c      stoa.Client
 	d      stoa.Dictionary
 	m      stoa.Mutex
@@ -37,6 +39,7 @@ func newStoa(ctx context.Context, bootstrap string, ttl time.Duration) (Storage,
 
 	return &stoaStorage{
 		logger: logging.NewLogger(DefaultStoaLoggerName),
+		ttl:    ttl,
 		c:      client,
 		m:      client.Mutex(DefaultStoaMutexName),
 		d:      client.Dictionary(DefaultStoaDictionaryName),
@@ -89,3 +92,35 @@ func (s *stoaStorage) DictionaryRemove(ctx context.Context, k []byte) (err error
 	}
 	return
 }
+
+func (s *stoaStorage) DictionaryPutTTL(ctx context.Context, k, v []byte) (err error) {
+	s.logger.Trace("dictionary put ttl")
+	_, err = s.d.Put(ctx, k, v, stoa.WithTTL(s.ttl))
+	if err != nil {
+		s.logger.Error("dictionary put ttl error", "message", err)
+	}
+	return
+}
+
+func (s *stoaStorage) DictionaryRange(ctx context.Context, p []byte) (r map[string][]byte, err error) {
+	s.logger.Trace("dictionary range")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r = make(map[string][]byte)
+	kvs, errs := s.d.Range(ctx)
+	for {
+		select {
+		case kv, ok := <-kvs:
+			if !ok {
+				return
+			}
+			if bytes.HasPrefix(kv[0], p) {
+				r[string(kv[0])] = kv[1]
+			}
+		case err = <-errs:
+			s.logger.Error("dictionary range error", "message", err)
+			return nil, err
+		}
+	}
+}
@@ -15,6 +15,13 @@ type Storage interface {
 	DictionaryGet(ctx context.Context, k []byte) ([]byte, error)
 
 	DictionaryRemove(ctx context.Context, k []byte) error
+
+	// DictionaryPutTTL puts the key-value pair which expires unless it is put
+	// again within the storage TTL.
+	DictionaryPutTTL(ctx context.Context, k, v []byte) error
+
+	// DictionaryRange returns all key-value pairs with the key prefix p.
+	DictionaryRange(ctx context.Context, p []byte) (map[string][]byte, error)
 }
 
 const (
@@ -5,6 +5,7 @@
 package mock_pg
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -35,110 +36,399 @@ func (m *MockCluster) EXPECT() *MockClusterMockRecorder {
 }
 
 // Alive mocks base method.
-func (m *MockCluster) Alive() (bool, error) {
+func (m *MockCluster) Alive(ctx context.Context) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Alive")
+	ret := m.ctrl.Call(m, "Alive", ctx)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Alive indicates an expected call of Alive.
-func (mr *MockClusterMockRecorder) Alive() *gomock.Call {
+func (mr *MockClusterMockRecorder) Alive(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Alive", reflect.TypeOf((*MockCluster)(nil).Alive))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Alive", reflect.TypeOf((*MockCluster)(nil).Alive), ctx)
+}
+
+// AlterSystem mocks base method.
+func (m *MockCluster) AlterSystem(ctx context.Context, set map[string]string, reset []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AlterSystem", ctx, set, reset)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AlterSystem indicates an expected call of AlterSystem.
+func (mr *MockClusterMockRecorder) AlterSystem(ctx, set, reset interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AlterSystem", reflect.TypeOf((*MockCluster)(nil).AlterSystem), ctx, set, reset)
 }
 
 // Backup mocks base method.
-func (m *MockCluster) Backup(host string, port int) error {
+func (m *MockCluster) Backup(ctx context.Context, host string, port int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Backup", host, port)
+	ret := m.ctrl.Call(m, "Backup", ctx, host, port)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Backup indicates an expected call of Backup.
-func (mr *MockClusterMockRecorder) Backup(host, port interface{}) *gomock.Call {
+func (mr *MockClusterMockRecorder) Backup(ctx, host, port interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Backup", reflect.TypeOf((*MockCluster)(nil).Backup), ctx, host, port)
+}
+
+// BackupJob mocks base method.
+func (m *MockCluster) BackupJob(ctx context.Context) *pg.BackupJob {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BackupJob", ctx)
+	ret0, _ := ret[0].(*pg.BackupJob)
+	return ret0
+}
+
+// BackupJob indicates an expected call of BackupJob.
+func (mr *MockClusterMockRecorder) BackupJob(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BackupJob", reflect.TypeOf((*MockCluster)(nil).BackupJob), ctx)
+}
+
+// Capabilities mocks base method.
+func (m *MockCluster) Capabilities(ctx context.Context) (*pg.Capabilities, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Capabilities", ctx)
+	ret0, _ := ret[0].(*pg.Capabilities)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Capabilities indicates an expected call of Capabilities.
+func (mr *MockClusterMockRecorder) Capabilities(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Capabilities", reflect.TypeOf((*MockCluster)(nil).Capabilities), ctx)
+}
+
+// ControlData mocks base method.
+func (m *MockCluster) ControlData(ctx context.Context) (*pg.ControlData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ControlData", ctx)
+	ret0, _ := ret[0].(*pg.ControlData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ControlData indicates an expected call of ControlData.
+func (mr *MockClusterMockRecorder) ControlData(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ControlData", reflect.TypeOf((*MockCluster)(nil).ControlData), ctx)
+}
+
+// CreateReplicationSlot mocks base method.
+func (m *MockCluster) CreateReplicationSlot(ctx context.Context, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateReplicationSlot", ctx, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateReplicationSlot indicates an expected call of CreateReplicationSlot.
+func (mr *MockClusterMockRecorder) CreateReplicationSlot(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateReplicationSlot", reflect.TypeOf((*MockCluster)(nil).CreateReplicationSlot), ctx, name)
+}
+
+// DeleteSnapshot mocks base method.
+func (m *MockCluster) DeleteSnapshot(ctx context.Context, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSnapshot", ctx, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSnapshot indicates an expected call of DeleteSnapshot.
+func (mr *MockClusterMockRecorder) DeleteSnapshot(ctx, name interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Backup", reflect.TypeOf((*MockCluster)(nil).Backup), host, port)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSnapshot", reflect.TypeOf((*MockCluster)(nil).DeleteSnapshot), ctx, name)
+}
+
+// DropReplicationSlot mocks base method.
+func (m *MockCluster) DropReplicationSlot(ctx context.Context, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DropReplicationSlot", ctx, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DropReplicationSlot indicates an expected call of DropReplicationSlot.
+func (mr *MockClusterMockRecorder) DropReplicationSlot(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DropReplicationSlot", reflect.TypeOf((*MockCluster)(nil).DropReplicationSlot), ctx, name)
 }
 
 // InRecovery mocks base method.
-func (m *MockCluster) InRecovery() (bool, error) {
+func (m *MockCluster) InRecovery(ctx context.Context) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "InRecovery")
+	ret := m.ctrl.Call(m, "InRecovery", ctx)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // InRecovery indicates an expected call of InRecovery.
-func (mr *MockClusterMockRecorder) InRecovery() *gomock.Call {
+func (mr *MockClusterMockRecorder) InRecovery(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InRecovery", reflect.TypeOf((*MockCluster)(nil).InRecovery))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InRecovery", reflect.TypeOf((*MockCluster)(nil).InRecovery), ctx)
 }
 
 // MasterInfo mocks base method.
-func (m *MockCluster) MasterInfo() (*pg.ConnectionInfo, error) {
+func (m *MockCluster) MasterInfo(ctx context.Context) (*pg.ConnectionInfo, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "MasterInfo")
+	ret := m.ctrl.Call(m, "MasterInfo", ctx)
 	ret0, _ := ret[0].(*pg.ConnectionInfo)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // MasterInfo indicates an expected call of MasterInfo.
-func (mr *MockClusterMockRecorder) MasterInfo() *gomock.Call {
+func (mr *MockClusterMockRecorder) MasterInfo(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MasterInfo", reflect.TypeOf((*MockCluster)(nil).MasterInfo), ctx)
+}
+
+// PendingRestart mocks base method.
+func (m *MockCluster) PendingRestart(ctx context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PendingRestart", ctx)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PendingRestart indicates an expected call of PendingRestart.
+func (mr *MockClusterMockRecorder) PendingRestart(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MasterInfo", reflect.TypeOf((*MockCluster)(nil).MasterInfo))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PendingRestart", reflect.TypeOf((*MockCluster)(nil).PendingRestart), ctx)
 }
 
 // Promote mocks base method.
-func (m *MockCluster) Promote() error {
+func (m *MockCluster) Promote(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Promote")
+	ret := m.ctrl.Call(m, "Promote", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Promote indicates an expected call of Promote.
-func (mr *MockClusterMockRecorder) Promote() *gomock.Call {
+func (mr *MockClusterMockRecorder) Promote(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Promote", reflect.TypeOf((*MockCluster)(nil).Promote))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Promote", reflect.TypeOf((*MockCluster)(nil).Promote), ctx)
+}
+
+// ReplicationSlots mocks base method.
+func (m *MockCluster) ReplicationSlots(ctx context.Context) ([]*pg.ReplicationSlot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplicationSlots", ctx)
+	ret0, _ := ret[0].([]*pg.ReplicationSlot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReplicationSlots indicates an expected call of ReplicationSlots.
+func (mr *MockClusterMockRecorder) ReplicationSlots(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplicationSlots", reflect.TypeOf((*MockCluster)(nil).ReplicationSlots), ctx)
+}
+
+// ReplicationStatus mocks base method.
+func (m *MockCluster) ReplicationStatus(ctx context.Context) ([]*pg.StandbyStatus, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplicationStatus", ctx)
+	ret0, _ := ret[0].([]*pg.StandbyStatus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReplicationStatus indicates an expected call of ReplicationStatus.
+func (mr *MockClusterMockRecorder) ReplicationStatus(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplicationStatus", reflect.TypeOf((*MockCluster)(nil).ReplicationStatus), ctx)
+}
+
+// Rewind mocks base method.
+func (m *MockCluster) Rewind(ctx context.Context, host string, port int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rewind", ctx, host, port)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rewind indicates an expected call of Rewind.
+func (mr *MockClusterMockRecorder) Rewind(ctx, host, port interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rewind", reflect.TypeOf((*MockCluster)(nil).Rewind), ctx, host, port)
+}
+
+// SetHBA mocks base method.
+func (m *MockCluster) SetHBA(ctx context.Context, rules []*pg.HBARule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetHBA", ctx, rules)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetHBA indicates an expected call of SetHBA.
+func (mr *MockClusterMockRecorder) SetHBA(ctx, rules interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetHBA", reflect.TypeOf((*MockCluster)(nil).SetHBA), ctx, rules)
+}
+
+// SetPrimary mocks base method.
+func (m *MockCluster) SetPrimary(ctx context.Context, host string, port int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPrimary", ctx, host, port)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPrimary indicates an expected call of SetPrimary.
+func (mr *MockClusterMockRecorder) SetPrimary(ctx, host, port interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPrimary", reflect.TypeOf((*MockCluster)(nil).SetPrimary), ctx, host, port)
+}
+
+// SetPrimarySlotName mocks base method.
+func (m *MockCluster) SetPrimarySlotName(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPrimarySlotName", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPrimarySlotName indicates an expected call of SetPrimarySlotName.
+func (mr *MockClusterMockRecorder) SetPrimarySlotName(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPrimarySlotName", reflect.TypeOf((*MockCluster)(nil).SetPrimarySlotName), ctx)
+}
+
+// SetReadOnly mocks base method.
+func (m *MockCluster) SetReadOnly(ctx context.Context, v bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetReadOnly", ctx, v)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetReadOnly indicates an expected call of SetReadOnly.
+func (mr *MockClusterMockRecorder) SetReadOnly(ctx, v interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReadOnly", reflect.TypeOf((*MockCluster)(nil).SetReadOnly), ctx, v)
+}
+
+// Snapshots mocks base method.
+func (m *MockCluster) Snapshots(ctx context.Context) ([]*pg.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Snapshots", ctx)
+	ret0, _ := ret[0].([]*pg.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Snapshots indicates an expected call of Snapshots.
+func (mr *MockClusterMockRecorder) Snapshots(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Snapshots", reflect.TypeOf((*MockCluster)(nil).Snapshots), ctx)
 }
 
 // Start mocks base method.
-func (m *MockCluster) Start() error {
+func (m *MockCluster) Start(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Start")
+	ret := m.ctrl.Call(m, "Start", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Start indicates an expected call of Start.
-func (mr *MockClusterMockRecorder) Start() *gomock.Call {
+func (mr *MockClusterMockRecorder) Start(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockCluster)(nil).Start))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockCluster)(nil).Start), ctx)
+}
+
+// StartBackupJob mocks base method.
+func (m *MockCluster) StartBackupJob(ctx context.Context, host string, port int, ready func()) (*pg.BackupJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartBackupJob", ctx, host, port, ready)
+	ret0, _ := ret[0].(*pg.BackupJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StartBackupJob indicates an expected call of StartBackupJob.
+func (mr *MockClusterMockRecorder) StartBackupJob(ctx, host, port, ready interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartBackupJob", reflect.TypeOf((*MockCluster)(nil).StartBackupJob), ctx, host, port, ready)
 }
 
 // Stop mocks base method.
-func (m *MockCluster) Stop() error {
+func (m *MockCluster) Stop(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Stop")
+	ret := m.ctrl.Call(m, "Stop", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Stop indicates an expected call of Stop.
-func (mr *MockClusterMockRecorder) Stop() *gomock.Call {
+func (mr *MockClusterMockRecorder) Stop(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockCluster)(nil).Stop))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockCluster)(nil).Stop), ctx)
+}
+
+// Stopped mocks base method.
+func (m *MockCluster) Stopped() <-chan struct{} {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stopped")
+	ret0, _ := ret[0].(<-chan struct{})
+	return ret0
+}
+
+// Stopped indicates an expected call of Stopped.
+func (mr *MockClusterMockRecorder) Stopped() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stopped", reflect.TypeOf((*MockCluster)(nil).Stopped))
+}
+
+// SystemSettings mocks base method.
+func (m *MockCluster) SystemSettings(ctx context.Context) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SystemSettings", ctx)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SystemSettings indicates an expected call of SystemSettings.
+func (mr *MockClusterMockRecorder) SystemSettings(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SystemSettings", reflect.TypeOf((*MockCluster)(nil).SystemSettings), ctx)
+}
+
+// Timeline mocks base method.
+func (m *MockCluster) Timeline(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Timeline", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Timeline indicates an expected call of Timeline.
+func (mr *MockClusterMockRecorder) Timeline(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Timeline", reflect.TypeOf((*MockCluster)(nil).Timeline), ctx)
 }
 
 // Version mocks base method.
-func (m *MockCluster) Version() (int, int, error) {
+func (m *MockCluster) Version(ctx context.Context) (int, int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Version")
+	ret := m.ctrl.Call(m, "Version", ctx)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(int)
 	ret2, _ := ret[2].(error)
@@ -146,7 +436,22 @@ func (m *MockCluster) Version() (int, int, error) {
 }
 
 // Version indicates an expected call of Version.
-func (mr *MockClusterMockRecorder) Version() *gomock.Call {
+func (mr *MockClusterMockRecorder) Version(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Version", reflect.TypeOf((*MockCluster)(nil).Version), ctx)
+}
+
+// WalPosition mocks base method.
+func (m *MockCluster) WalPosition(ctx context.Context) (*pg.WalPosition, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WalPosition", ctx)
+	ret0, _ := ret[0].(*pg.WalPosition)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WalPosition indicates an expected call of WalPosition.
+func (mr *MockClusterMockRecorder) WalPosition(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Version", reflect.TypeOf((*MockCluster)(nil).Version))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WalPosition", reflect.TypeOf((*MockCluster)(nil).WalPosition), ctx)
 }
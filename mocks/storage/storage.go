@@ -63,6 +63,35 @@ func (mr *MockStorageMockRecorder) DictionaryPut(ctx, k, v interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DictionaryPut", reflect.TypeOf((*MockStorage)(nil).DictionaryPut), ctx, k, v)
 }
 
+// DictionaryPutTTL mocks base method.
+func (m *MockStorage) DictionaryPutTTL(ctx context.Context, k, v []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DictionaryPutTTL", ctx, k, v)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DictionaryPutTTL indicates an expected call of DictionaryPutTTL.
+func (mr *MockStorageMockRecorder) DictionaryPutTTL(ctx, k, v interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DictionaryPutTTL", reflect.TypeOf((*MockStorage)(nil).DictionaryPutTTL), ctx, k, v)
+}
+
+// DictionaryRange mocks base method.
+func (m *MockStorage) DictionaryRange(ctx context.Context, p []byte) (map[string][]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DictionaryRange", ctx, p)
+	ret0, _ := ret[0].(map[string][]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DictionaryRange indicates an expected call of DictionaryRange.
+func (mr *MockStorageMockRecorder) DictionaryRange(ctx, p interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DictionaryRange", reflect.TypeOf((*MockStorage)(nil).DictionaryRange), ctx, p)
+}
+
 // DictionaryRemove mocks base method.
 func (m *MockStorage) DictionaryRemove(ctx context.Context, k []byte) error {
 	m.ctrl.T.Helper()